@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/node"
+	"github.com/vazj/blocker/types"
+)
+
+// shutdownTimeout bounds how long a node gets to shut down gracefully.
+const shutdownTimeout = 10 * time.Second
+
+// parseFlags parses args into fs, treating -h as a successful no-op.
+func parseFlags(fs *flag.FlagSet, args []string) (bool, error) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return false, nil
+		}
+		return false, err
+	}
+	if fs.NArg() > 0 {
+		return false, fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+	return true, nil
+}
+
+// nodeFlags are the flags overriding the configuration file.
+type nodeFlags struct {
+	configFile string
+	fs         *flag.FlagSet
+	overrides  map[string]func(c *Config, v string)
+}
+
+func newNodeFlags(name string, out io.Writer) *nodeFlags {
+	f := &nodeFlags{
+		fs: flag.NewFlagSet(name, flag.ContinueOnError),
+		overrides: map[string]func(c *Config, v string){
+			"listen":        func(c *Config, v string) { c.ListenAddr = v },
+			"bootstrap":     func(c *Config, v string) { c.Bootstrap = splitList(v) },
+			"data-dir":      func(c *Config, v string) { c.DataDir = v },
+			"validator-key": func(c *Config, v string) { c.ValidatorKeyFile = v },
+			"admin":         func(c *Config, v string) { c.AdminAddr = v },
+			"log-level":     func(c *Config, v string) { c.LogLevel = v },
+		},
+	}
+	f.fs.SetOutput(out)
+	f.fs.StringVar(&f.configFile, "config", "", "path of the YAML configuration file")
+	f.fs.String("listen", "", "address to listen on")
+	f.fs.String("bootstrap", "", "comma separated addresses of the nodes to bootstrap from")
+	f.fs.String("data-dir", "", "directory holding the node data")
+	f.fs.String("validator-key", "", "key file blocks are signed with, validators only")
+	f.fs.String("admin", "", "address of the admin service, disabled when empty")
+	f.fs.String("log-level", "", "minimum level of the logs")
+	return f
+}
+
+// config loads the configuration file and applies the environment and the
+// flags set on the command line.
+func (f *nodeFlags) config() (*Config, error) {
+	cfg, err := loadConfig(f.configFile, os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	f.fs.Visit(func(fl *flag.Flag) {
+		if set, ok := f.overrides[fl.Name]; ok {
+			set(cfg, fl.Value.String())
+		}
+	})
+	return cfg, nil
+}
+
+func runNodeStart(args []string, out io.Writer) error {
+	flags := newNodeFlags("node start", out)
+	if ok, err := parseFlags(flags.fs, args); !ok {
+		return err
+	}
+	cfg, err := flags.config()
+	if err != nil {
+		return err
+	}
+	serverCfg, err := cfg.serverConfig()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	n := node.NewNode(serverCfg)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- n.Start(cfg.ListenAddr, cfg.Bootstrap)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := n.Stop(stopCtx); err != nil {
+		return err
+	}
+	return <-errc
+}
+
+func runKeygen(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	fs.SetOutput(out)
+	keyFile := fs.String("out", "", "file to store the key in, printed when empty")
+	if ok, err := parseFlags(fs, args); !ok {
+		return err
+	}
+
+	privKey := crypto.GeneratePrivateKey()
+	if *keyFile != "" {
+		if err := node.SaveKey(*keyFile, privKey); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "key:        %s\n", *keyFile)
+	} else {
+		fmt.Fprintf(out, "seed:       %s\n", hex.EncodeToString(privKey.Seed()))
+	}
+	fmt.Fprintf(out, "public key: %s\n", hex.EncodeToString(privKey.Public().Bytes()))
+	fmt.Fprintf(out, "address:    %s\n", privKey.Public().Address())
+	return nil
+}
+
+// allocFlag collects the "address=amount" genesis allocations.
+type allocFlag []node.GenesisAlloc
+
+func (a *allocFlag) String() string {
+	allocs := make([]string, 0, len(*a))
+	for _, alloc := range *a {
+		allocs = append(allocs, fmt.Sprintf("%x=%d", alloc.Address, alloc.Amount))
+	}
+	return strings.Join(allocs, ",")
+}
+
+func (a *allocFlag) Set(s string) error {
+	addr, amount, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("allocation %q is not address=amount", s)
+	}
+	address, err := hex.DecodeString(addr)
+	if err != nil || len(address) != crypto.AddressLen {
+		return fmt.Errorf("invalid address %q", addr)
+	}
+	value, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil || value <= 0 {
+		return fmt.Errorf("invalid amount %q", amount)
+	}
+	*a = append(*a, node.GenesisAlloc{Address: address, Amount: value})
+	return nil
+}
+
+func runGenesisInit(args []string, out io.Writer) error {
+	var (
+		flags   = newNodeFlags("genesis init", out)
+		keyFile = flags.fs.String("key", "genesis.key", "key file the genesis is signed with, created when missing")
+		allocs  allocFlag
+	)
+	flags.fs.Var(&allocs, "alloc", "address=amount credited in the genesis, can be repeated")
+	if ok, err := parseFlags(flags.fs, args); !ok {
+		return err
+	}
+	if len(allocs) == 0 {
+		return errors.New("the genesis needs at least one allocation")
+	}
+	cfg, err := flags.config()
+	if err != nil {
+		return err
+	}
+
+	path := cfg.path(cfg.GenesisFile)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("genesis %s already exists", path)
+	}
+	privKey, err := node.LoadKey(cfg.path(*keyFile))
+	if errors.Is(err, os.ErrNotExist) {
+		privKey = crypto.GeneratePrivateKey()
+		err = node.SaveKey(cfg.path(*keyFile), privKey)
+	}
+	if err != nil {
+		return err
+	}
+
+	genesis := node.NewGenesisBlock(privKey, time.Now().UnixNano(), allocs)
+	if err := node.SaveGenesis(path, genesis); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "genesis: %s\n", path)
+	fmt.Fprintf(out, "hash:    %s\n", hex.EncodeToString(types.HashBlock(genesis)))
+	return nil
+}
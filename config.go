@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vazj/blocker/node"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is the prefix of the environment variables overriding the
+// configuration file.
+const envPrefix = "BLOCKER_"
+
+// Config is the configuration of a node, read from a YAML file and
+// overridden by environment variables and command line flags, in that
+// order. Relative paths are relative to DataDir.
+type Config struct {
+	Version    string   `yaml:"version"`
+	ListenAddr string   `yaml:"listen_addr"`
+	Bootstrap  []string `yaml:"bootstrap"`
+	// DataDir holds the identity key, the address book and the genesis.
+	DataDir string `yaml:"data_dir"`
+	// ValidatorKeyFile is the key blocks are signed with, only validators
+	// have one.
+	ValidatorKeyFile string `yaml:"validator_key_file"`
+	// IdentityKeyFile is created on first start when it doesn't exist.
+	IdentityKeyFile string `yaml:"identity_key_file"`
+	// GenesisFile is the genesis written by "genesis init", the built-in
+	// genesis is used when the file doesn't exist.
+	GenesisFile string      `yaml:"genesis_file"`
+	AdminAddr   string      `yaml:"admin_addr"`
+	LogLevel    string      `yaml:"log_level"`
+	TLS         TLSConfig   `yaml:"tls"`
+	Peers       PeersConfig `yaml:"peers"`
+	Chain       ChainConfig `yaml:"chain"`
+}
+
+type TLSConfig struct {
+	Enabled           bool     `yaml:"enabled"`
+	CertFile          string   `yaml:"cert_file"`
+	KeyFile           string   `yaml:"key_file"`
+	CAFile            string   `yaml:"ca_file"`
+	MutualTLS         bool     `yaml:"mutual_tls"`
+	TrustedIdentities []string `yaml:"trusted_identities"`
+}
+
+type PeersConfig struct {
+	MinOutbound int `yaml:"min_outbound"`
+	MaxOutbound int `yaml:"max_outbound"`
+	MaxInbound  int `yaml:"max_inbound"`
+}
+
+// ChainConfig holds the consensus parameters, zero values get the default.
+type ChainConfig struct {
+	MaxBlockBytes int `yaml:"max_block_bytes"`
+	MaxBlockTxs   int `yaml:"max_block_txs"`
+	MaxTxBytes    int `yaml:"max_tx_bytes"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Version:         "Blocker-1",
+		ListenAddr:      "127.0.0.1:3000",
+		DataDir:         ".blocker",
+		IdentityKeyFile: "identity.key",
+		GenesisFile:     "genesis.json",
+		LogLevel:        "info",
+	}
+}
+
+// envVars are the settings that can be overridden from the environment,
+// by name without envPrefix.
+var envVars = map[string]func(c *Config, v string){
+	"LISTEN_ADDR":        func(c *Config, v string) { c.ListenAddr = v },
+	"BOOTSTRAP":          func(c *Config, v string) { c.Bootstrap = splitList(v) },
+	"DATA_DIR":           func(c *Config, v string) { c.DataDir = v },
+	"VALIDATOR_KEY_FILE": func(c *Config, v string) { c.ValidatorKeyFile = v },
+	"IDENTITY_KEY_FILE":  func(c *Config, v string) { c.IdentityKeyFile = v },
+	"GENESIS_FILE":       func(c *Config, v string) { c.GenesisFile = v },
+	"ADMIN_ADDR":         func(c *Config, v string) { c.AdminAddr = v },
+	"LOG_LEVEL":          func(c *Config, v string) { c.LogLevel = v },
+}
+
+// loadConfig reads the configuration file at path on top of the defaults,
+// if path isn't empty, and applies the environment variables found with
+// lookupEnv.
+func loadConfig(path string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := defaultConfig()
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("parsing config %s: %w", path, err)
+		}
+	}
+	for name, set := range envVars {
+		if v, ok := lookupEnv(envPrefix + name); ok {
+			set(cfg, v)
+		}
+	}
+	return cfg, nil
+}
+
+// path resolves p relative to the data directory.
+func (c *Config) path(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(c.DataDir, p)
+}
+
+// serverConfig loads the keys and genesis the configuration points to.
+func (c *Config) serverConfig() (node.ServerConfig, error) {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return node.ServerConfig{}, fmt.Errorf("invalid log level %q", c.LogLevel)
+	}
+	// peers dial the address we advertise and we dial the bootstrap
+	// nodes, without a host either would only mean this machine
+	if err := checkAddr("listen_addr", c.ListenAddr); err != nil {
+		return node.ServerConfig{}, err
+	}
+	for _, addr := range c.Bootstrap {
+		if err := checkAddr("bootstrap address", addr); err != nil {
+			return node.ServerConfig{}, err
+		}
+	}
+	identityKey, err := node.LoadOrCreateIdentity(c.path(c.IdentityKeyFile))
+	if err != nil {
+		return node.ServerConfig{}, fmt.Errorf("loading identity key: %w", err)
+	}
+	cfg := node.ServerConfig{
+		Version:     c.Version,
+		ListenAddr:  c.ListenAddr,
+		IdentityKey: identityKey,
+		TLS: node.TLSConfig{
+			Enabled:           c.TLS.Enabled,
+			CertFile:          c.path(c.TLS.CertFile),
+			KeyFile:           c.path(c.TLS.KeyFile),
+			CAFile:            c.path(c.TLS.CAFile),
+			MutualTLS:         c.TLS.MutualTLS,
+			TrustedIdentities: c.TLS.TrustedIdentities,
+		},
+		ConsensusParams:  c.consensusParams(),
+		AddrBookFile:     c.path("addrbook.json"),
+		MinOutboundPeers: c.Peers.MinOutbound,
+		MaxOutboundPeers: c.Peers.MaxOutbound,
+		MaxInboundPeers:  c.Peers.MaxInbound,
+		AdminAddr:        c.AdminAddr,
+		LogLevel:         level,
+	}
+	if c.ValidatorKeyFile != "" {
+		if cfg.PrivateKey, err = node.LoadKey(c.path(c.ValidatorKeyFile)); err != nil {
+			return node.ServerConfig{}, fmt.Errorf("loading validator key: %w", err)
+		}
+	}
+	if c.GenesisFile != "" {
+		genesis, err := node.LoadGenesis(c.path(c.GenesisFile))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return node.ServerConfig{}, fmt.Errorf("loading genesis: %w", err)
+		}
+		cfg.Genesis = genesis
+	}
+	return cfg, nil
+}
+
+func (c *Config) consensusParams() node.ConsensusParams {
+	params := node.DefaultConsensusParams()
+	if c.Chain.MaxBlockBytes != 0 {
+		params.MaxBlockBytes = c.Chain.MaxBlockBytes
+	}
+	if c.Chain.MaxBlockTxs != 0 {
+		params.MaxBlockTxs = c.Chain.MaxBlockTxs
+	}
+	if c.Chain.MaxTxBytes != 0 {
+		params.MaxTxBytes = c.Chain.MaxTxBytes
+	}
+	return params
+}
+
+// checkAddr checks that addr is a host:port with a host.
+func checkAddr(name, addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", name, addr, err)
+	}
+	if host == "" {
+		return fmt.Errorf("%s %q has no host, other machines can't reach it", name, addr)
+	}
+	return nil
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(s string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/node"
+	"github.com/vazj/blocker/types"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "node.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `
+listen_addr: ":4000"
+bootstrap: [":3000", ":5000"]
+data_dir: /var/lib/blocker
+log_level: warn
+chain:
+  max_tx_bytes: 1000
+`)
+	env := map[string]string{
+		"BLOCKER_LISTEN_ADDR": ":6000",
+		"BLOCKER_BOOTSTRAP":   ":7000, :8000",
+	}
+	cfg, err := loadConfig(path, func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, ":6000", cfg.ListenAddr)
+	assert.Equal(t, []string{":7000", ":8000"}, cfg.Bootstrap)
+	assert.Equal(t, "warn", cfg.LogLevel)
+	assert.Equal(t, "/var/lib/blocker/identity.key", cfg.path(cfg.IdentityKeyFile))
+	assert.Equal(t, "/etc/genesis.json", cfg.path("/etc/genesis.json"))
+
+	params := cfg.consensusParams()
+	assert.Equal(t, 1000, params.MaxTxBytes)
+	assert.Equal(t, node.DefaultConsensusParams().MaxBlockBytes, params.MaxBlockBytes)
+}
+
+func TestLoadConfigUnknownField(t *testing.T) {
+	_, err := loadConfig(writeConfig(t, "listen: \":4000\"\n"), os.LookupEnv)
+	assert.Error(t, err)
+}
+
+func TestNodeFlagsOverrideConfig(t *testing.T) {
+	t.Setenv("BLOCKER_LOG_LEVEL", "error")
+	t.Setenv("BLOCKER_ADMIN_ADDR", "127.0.0.1:9000")
+	path := writeConfig(t, "listen_addr: \":4000\"\nlog_level: warn\n")
+
+	flags := newNodeFlags("node start", &bytes.Buffer{})
+	ok, err := parseFlags(flags.fs, []string{"-config", path, "-log-level", "debug", "-bootstrap", ":3000"})
+	require.NoError(t, err)
+	require.True(t, ok)
+	cfg, err := flags.config()
+	require.NoError(t, err)
+
+	assert.Equal(t, ":4000", cfg.ListenAddr)
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, "127.0.0.1:9000", cfg.AdminAddr)
+	assert.Equal(t, []string{":3000"}, cfg.Bootstrap)
+}
+
+func TestServerConfigRequiresHosts(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.Bootstrap = []string{"192.0.2.11:3000"}
+	_, err := cfg.serverConfig()
+	require.NoError(t, err)
+
+	cfg.ListenAddr = ":3000"
+	_, err = cfg.serverConfig()
+	assert.ErrorContains(t, err, "no host")
+
+	cfg.ListenAddr = "0.0.0.0:3000"
+	cfg.Bootstrap = []string{"192.0.2.11:3000", ":4000"}
+	_, err = cfg.serverConfig()
+	assert.ErrorContains(t, err, "no host")
+
+	cfg.Bootstrap = []string{"192.0.2.11"}
+	_, err = cfg.serverConfig()
+	assert.Error(t, err)
+}
+
+func TestKeygen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "validator.key")
+	out := &bytes.Buffer{}
+	require.NoError(t, run([]string{"keygen", "-out", path}, out))
+	privKey, err := node.LoadKey(path)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), privKey.Public().Address().String())
+
+	// keys are never overwritten
+	assert.Error(t, run([]string{"keygen", "-out", path}, out))
+}
+
+func TestGenesisInit(t *testing.T) {
+	var (
+		dataDir = t.TempDir()
+		address = crypto.GeneratePrivateKey().Public().Address()
+		out     = &bytes.Buffer{}
+	)
+	args := []string{"genesis", "init", "-data-dir", dataDir, "-alloc", address.String() + "=5000"}
+	require.NoError(t, run(args, out))
+
+	cfg, err := loadConfig("", func(string) (string, bool) { return "", false })
+	require.NoError(t, err)
+	cfg.DataDir = dataDir
+	serverCfg, err := cfg.serverConfig()
+	require.NoError(t, err)
+	require.NotNil(t, serverCfg.Genesis)
+	assert.Contains(t, out.String(), hex.EncodeToString(types.HashBlock(serverCfg.Genesis)))
+	outputs := serverCfg.Genesis.Transactions[0].Outputs
+	require.Len(t, outputs, 1)
+	assert.Equal(t, address.Bytes(), outputs[0].Address)
+	assert.Equal(t, int64(5000), outputs[0].Amount)
+
+	// an existing genesis is never overwritten
+	assert.Error(t, run(args, out))
+}
+
+func TestRunUsage(t *testing.T) {
+	assert.ErrorIs(t, run(nil, &bytes.Buffer{}), errUsage)
+	assert.ErrorIs(t, run([]string{"node"}, &bytes.Buffer{}), errUsage)
+	assert.ErrorIs(t, run([]string{"genesis", "create"}, &bytes.Buffer{}), errUsage)
+}
@@ -0,0 +1,136 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// HardenedOffset is added to the index of the hardened children. Only
+	// hardened derivation is defined for ed25519.
+	HardenedOffset uint32 = 0x80000000
+	// MinSeedLen and MaxSeedLen bound the length of a master seed.
+	MinSeedLen = 16
+	MaxSeedLen = 64
+)
+
+// masterSecret is the HMAC key the master key is derived with in SLIP-10.
+var masterSecret = []byte("ed25519 seed")
+
+var (
+	ErrInvalidSeed = errors.New("invalid seed length")
+	ErrNotHardened = errors.New("ed25519 keys only have hardened children")
+	ErrInvalidPath = errors.New("invalid derivation path")
+)
+
+// HDKey is a node of a SLIP-10 ed25519 key tree: a key along with the chain
+// code its children are derived with.
+type HDKey struct {
+	seed      []byte
+	chainCode []byte
+	depth     int
+}
+
+// NewMasterKey returns the root of the key tree of seed.
+func NewMasterKey(seed []byte) (*HDKey, error) {
+	if len(seed) < MinSeedLen || len(seed) > MaxSeedLen {
+		return nil, fmt.Errorf("%w: %d bytes", ErrInvalidSeed, len(seed))
+	}
+	mac := hmac.New(sha512.New, masterSecret)
+	mac.Write(seed)
+	return newHDKey(mac.Sum(nil), 0), nil
+}
+
+func newHDKey(i []byte, depth int) *HDKey {
+	return &HDKey{
+		seed:      i[:SeedLen],
+		chainCode: i[SeedLen:],
+		depth:     depth,
+	}
+}
+
+// Child derives the child at index, which has to be hardened.
+func (k *HDKey) Child(index uint32) (*HDKey, error) {
+	if index < HardenedOffset {
+		return nil, fmt.Errorf("%w: index %d", ErrNotHardened, index)
+	}
+	data := make([]byte, 0, 1+SeedLen+4)
+	data = append(data, 0)
+	data = append(data, k.seed...)
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	return newHDKey(mac.Sum(nil), k.depth+1), nil
+}
+
+// Derive derives the descendant of k at path, "m" standing for k.
+func (k *HDKey) Derive(path string) (*HDKey, error) {
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	child := k
+	for _, index := range indexes {
+		if child, err = child.Child(index); err != nil {
+			return nil, err
+		}
+	}
+	return child, nil
+}
+
+// PrivateKey returns the signing key of the node.
+func (k *HDKey) PrivateKey() *PrivateKey {
+	return NewPrivateKeyFromSeed(k.seed)
+}
+
+// ChainCode returns the chain code of the node.
+func (k *HDKey) ChainCode() []byte {
+	return k.chainCode
+}
+
+// Depth returns the number of derivations from the master key.
+func (k *HDKey) Depth() int {
+	return k.depth
+}
+
+// ParsePath parses a derivation path such as "m/44'/0'/1'" into the
+// indexes of its levels. Every level has to be hardened, marked with ' or
+// h.
+func ParsePath(path string) ([]uint32, error) {
+	levels := strings.Split(path, "/")
+	if levels[0] != "m" {
+		return nil, fmt.Errorf("%w: %q doesn't start with m", ErrInvalidPath, path)
+	}
+	indexes := make([]uint32, 0, len(levels)-1)
+	for _, level := range levels[1:] {
+		trimmed := strings.TrimRight(level, "'h")
+		if len(level)-len(trimmed) != 1 {
+			return nil, fmt.Errorf("%w: level %q of %q isn't hardened", ErrNotHardened, level, path)
+		}
+		index, err := strconv.ParseUint(trimmed, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("%w: level %q of %q", ErrInvalidPath, level, path)
+		}
+		indexes = append(indexes, uint32(index)+HardenedOffset)
+	}
+	return indexes, nil
+}
+
+// DeriveKey derives the key at path from seed.
+func DeriveKey(seed []byte, path string) (*PrivateKey, error) {
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	k, err := master.Derive(path)
+	if err != nil {
+		return nil, err
+	}
+	return k.PrivateKey(), nil
+}
@@ -0,0 +1,96 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vector 1 for ed25519 of SLIP-10.
+func TestDeriveSLIP10Vectors(t *testing.T) {
+	seed, err := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	require.NoError(t, err)
+	master, err := NewMasterKey(seed)
+	require.NoError(t, err)
+
+	vectors := []struct {
+		path      string
+		chainCode string
+		seed      string
+		pubKey    string
+	}{
+		{
+			path:      "m",
+			chainCode: "90046a93de5380a72b5e45010748567d5ea02bbf6522f979e05c0d8d8ca9fffb",
+			seed:      "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7",
+			pubKey:    "a4b2856bfec510abab89753fac1ac0e1112364e7d250545963f135f2a33188ed",
+		},
+		{
+			path:      "m/0'",
+			chainCode: "8b59aa11380b624e81507a27fedda59fea6d0b779a778918a2fd3590e16e9c69",
+			seed:      "68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3",
+			pubKey:    "8c8a13df77a28f3445213a0f432fde644acaa215fc72dcdf300d5efaa85d350c",
+		},
+		{
+			path:      "m/0'/1'/2'",
+			chainCode: "2e69929e00b5ab250f49c3fb1c12f252de4fed2c1db88387094a0f8c4c9ccd6c",
+			seed:      "92a5b23c0b8a99e37d07df3fb9966917f5d06e02ddbd909c7e184371463e9fc9",
+			pubKey:    "ae98736566d30ed0e9d2f4486a64bc95740d89c7db33f52121f8ea8f76ff0fc1",
+		},
+		{
+			path:      "m/0h/1h/2h/2h/1000000000h",
+			chainCode: "68789923a0cac2cd5a29172a475fe9e0fb14cd6adb5ad98a3fa70333e7afa230",
+			seed:      "8f94d394a8e8fd6b1bc2f3f49f5c47e385281d5c17e65324b0f62483e37e8793",
+			pubKey:    "3c24da049451555d51a7014a37337aa4e12d41e485abccfa46b47dfb2af54b7a",
+		},
+	}
+	for _, v := range vectors {
+		k, err := master.Derive(v.path)
+		require.NoError(t, err, v.path)
+		assert.Equal(t, v.chainCode, hex.EncodeToString(k.ChainCode()), v.path)
+		assert.Equal(t, v.seed, hex.EncodeToString(k.PrivateKey().Seed()), v.path)
+		assert.Equal(t, v.pubKey, hex.EncodeToString(k.PrivateKey().Public().Bytes()), v.path)
+	}
+}
+
+func TestDeriveKeyIsDeterministic(t *testing.T) {
+	seed := make([]byte, 32)
+	a, err := DeriveKey(seed, "m/44'/0'/0'")
+	require.NoError(t, err)
+	b, err := DeriveKey(seed, "m/44'/0'/0'")
+	require.NoError(t, err)
+	c, err := DeriveKey(seed, "m/44'/0'/1'")
+	require.NoError(t, err)
+	assert.True(t, a.Equals(b))
+	assert.False(t, a.Equals(c))
+
+	master, err := NewMasterKey(seed)
+	require.NoError(t, err)
+	account, err := master.Derive("m/44'/0'")
+	require.NoError(t, err)
+	assert.Equal(t, 2, account.Depth())
+	child, err := account.Derive("m/0'")
+	require.NoError(t, err)
+	assert.True(t, a.Equals(child.PrivateKey()))
+}
+
+func TestDeriveRejectsInvalidInput(t *testing.T) {
+	_, err := NewMasterKey(make([]byte, 8))
+	assert.ErrorIs(t, err, ErrInvalidSeed)
+
+	master, err := NewMasterKey(make([]byte, 32))
+	require.NoError(t, err)
+	_, err = master.Child(1)
+	assert.ErrorIs(t, err, ErrNotHardened)
+
+	for _, path := range []string{"m/0", "m/0'/1", "m/1''"} {
+		_, err = master.Derive(path)
+		assert.ErrorIs(t, err, ErrNotHardened, path)
+	}
+	for _, path := range []string{"", "0'", "m/x'", "m/2147483648'", "m//"} {
+		_, err = master.Derive(path)
+		assert.Error(t, err, path)
+	}
+}
@@ -33,6 +33,13 @@ func TestNewPrivateKeyFromSeed(t *testing.T) {
 	assert.Equal(t, PrivKeyLen, len(privKey.Bytes()))
 }
 
+func TestPrivateKey_Seed(t *testing.T) {
+	privKey := GeneratePrivateKey()
+	seed := privKey.Seed()
+	assert.Equal(t, SeedLen, len(seed))
+	assert.True(t, privKey.Equals(NewPrivateKeyFromSeed(seed)))
+}
+
 func TestNewPrivateKey(t *testing.T) {
 	privKey := NewPrivateKey()
 	assert.Equal(t, PrivKeyLen, len(privKey.Bytes()))
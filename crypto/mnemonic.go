@@ -0,0 +1,195 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// MnemonicEntropyBits is the entropy of the 24 word mnemonics
+	// GenerateMnemonic returns.
+	MnemonicEntropyBits = 256
+	// mnemonicSeedIterations is the PBKDF2 iteration count of BIP-39.
+	mnemonicSeedIterations = 2048
+	// bitsPerWord is the number of bits a word of the list encodes.
+	bitsPerWord = 11
+)
+
+// englishWords is the English wordlist of BIP-39, whose SHA256 is
+// 2f5eed53a4727b4bf8880d8f3f199efc90e58503646d9ff8eff3a2ed3b24dbda.
+//
+//go:embed wordlists/english.txt
+var englishWords string
+
+var (
+	wordlist    = strings.Fields(englishWords)
+	wordIndexes = indexWords(wordlist)
+)
+
+func indexWords(words []string) map[string]int {
+	indexes := make(map[string]int, len(words))
+	for i, word := range words {
+		indexes[word] = i
+	}
+	return indexes
+}
+
+var (
+	ErrInvalidEntropy  = errors.New("entropy has to be 128 to 256 bits, by 32")
+	ErrInvalidMnemonic = errors.New("invalid mnemonic")
+)
+
+// GenerateMnemonic returns a new random 24 word mnemonic.
+func GenerateMnemonic() string {
+	entropy := make([]byte, MnemonicEntropyBits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		panic(err)
+	}
+	mnemonic, err := NewMnemonic(entropy)
+	if err != nil {
+		panic(err)
+	}
+	return mnemonic
+}
+
+// NewMnemonic encodes entropy, 16 to 32 bytes by steps of 4, into a BIP-39
+// mnemonic: the entropy followed by the first bits of its SHA256 as a
+// checksum, 11 bits per word.
+func NewMnemonic(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return "", fmt.Errorf("%w: got %d bits", ErrInvalidEntropy, bits)
+	}
+	var (
+		checksum = sha256.Sum256(entropy)
+		data     = append(append([]byte{}, entropy...), checksum[0])
+		n        = (bits + bits/32) / bitsPerWord
+		words    = make([]string, n)
+	)
+	for i := range words {
+		words[i] = wordlist[readBits(data, i*bitsPerWord, bitsPerWord)]
+	}
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicToEntropy decodes mnemonic and checks its checksum.
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	switch len(words) {
+	case 12, 15, 18, 21, 24:
+	default:
+		return nil, fmt.Errorf("%w: %d words", ErrInvalidMnemonic, len(words))
+	}
+
+	var (
+		totalBits = len(words) * bitsPerWord
+		checkBits = totalBits / 33
+		data      = make([]byte, (totalBits+7)/8)
+	)
+	for i, word := range words {
+		index, ok := wordIndexes[word]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown word %q", ErrInvalidMnemonic, word)
+		}
+		writeBits(data, i*bitsPerWord, bitsPerWord, index)
+	}
+
+	entropy := data[:(totalBits-checkBits)/8]
+	checksum := sha256.Sum256(entropy)
+	want := int(checksum[0]) >> (8 - checkBits)
+	if got := readBits(data, len(entropy)*8, checkBits); got != want {
+		return nil, fmt.Errorf("%w: bad checksum", ErrInvalidMnemonic)
+	}
+	return entropy, nil
+}
+
+// ValidateMnemonic checks the words and the checksum of mnemonic.
+func ValidateMnemonic(mnemonic string) error {
+	_, err := MnemonicToEntropy(mnemonic)
+	return err
+}
+
+// MnemonicToSeed returns the 64 byte BIP-39 seed of mnemonic protected by
+// passphrase, which may be empty. Any passphrase gives a valid seed, a
+// wrong one just leads to other keys.
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+	var (
+		password = norm.NFKD.String(strings.Join(strings.Fields(mnemonic), " "))
+		salt     = norm.NFKD.String("mnemonic" + passphrase)
+	)
+	return pbkdf2SHA512([]byte(password), []byte(salt), mnemonicSeedIterations), nil
+}
+
+// NewMasterKeyFromMnemonic returns the root of the key tree of the seed of
+// mnemonic, what a wallet is restored from.
+func NewMasterKeyFromMnemonic(mnemonic, passphrase string) (*HDKey, error) {
+	seed, err := MnemonicToSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return NewMasterKey(seed)
+}
+
+// NewPrivateKeyFromMnemonic derives the key at path from the seed of
+// mnemonic.
+func NewPrivateKeyFromMnemonic(mnemonic, passphrase, path string) (*PrivateKey, error) {
+	seed, err := MnemonicToSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return DeriveKey(seed, path)
+}
+
+// readBits returns the n bits of data starting at bit offset, most
+// significant first.
+func readBits(data []byte, offset, n int) int {
+	v := 0
+	for i := offset; i < offset+n; i++ {
+		v <<= 1
+		if data[i/8]&(1<<(7-i%8)) != 0 {
+			v |= 1
+		}
+	}
+	return v
+}
+
+// writeBits writes the n low bits of v into data starting at bit offset.
+func writeBits(data []byte, offset, n, v int) {
+	for i := 0; i < n; i++ {
+		if v&(1<<(n-1-i)) != 0 {
+			pos := offset + i
+			data[pos/8] |= 1 << (7 - pos%8)
+		}
+	}
+}
+
+// pbkdf2SHA512 derives a key of the size of a SHA512 hash with PBKDF2, a
+// single block being all BIP-39 needs.
+func pbkdf2SHA512(password, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha512.New, password)
+	mac.Write(salt)
+	mac.Write(binary.BigEndian.AppendUint32(nil, 1))
+	u := mac.Sum(nil)
+	key := append([]byte{}, u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
@@ -0,0 +1,110 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors of BIP-39, all with the passphrase "TREZOR".
+func TestMnemonicVectors(t *testing.T) {
+	vectors := []struct {
+		entropy  string
+		mnemonic string
+		seed     string
+	}{
+		{
+			entropy:  "00000000000000000000000000000000",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			seed:     "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		},
+		{
+			entropy:  "7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			mnemonic: "legal winner thank year wave sausage worth useful legal winner thank yellow",
+			seed:     "2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		},
+		{
+			entropy:  "808080808080808080808080808080808080808080808080",
+			mnemonic: "letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic avoid letter always",
+			seed:     "107d7c02a5aa6f38c58083ff74f04c607c2d2c0ecc55501dadd72d025b751bc27fe913ffb796f841c49b1d33b610cf0e91d3aa239027f5e99fe4ce9e5088cd65",
+		},
+		{
+			entropy:  "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			mnemonic: "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+			seed:     "dd48c104698c30cfe2b6142103248622fb7bb0ff692eebb00089b32d22484e1613912f0a5b694407be899ffd31ed3992c456cdf60f5d4564b8ba3f05a69890ad",
+		},
+	}
+	for _, v := range vectors {
+		entropy, err := hex.DecodeString(v.entropy)
+		require.NoError(t, err)
+
+		mnemonic, err := NewMnemonic(entropy)
+		require.NoError(t, err)
+		assert.Equal(t, v.mnemonic, mnemonic)
+
+		decoded, err := MnemonicToEntropy(mnemonic)
+		require.NoError(t, err)
+		assert.Equal(t, entropy, decoded)
+
+		seed, err := MnemonicToSeed(mnemonic, "TREZOR")
+		require.NoError(t, err)
+		assert.Equal(t, v.seed, hex.EncodeToString(seed))
+	}
+}
+
+func TestGenerateMnemonic(t *testing.T) {
+	mnemonic := GenerateMnemonic()
+	assert.Len(t, strings.Fields(mnemonic), 24)
+	assert.NoError(t, ValidateMnemonic(mnemonic))
+	assert.NotEqual(t, mnemonic, GenerateMnemonic())
+
+	_, err := NewMnemonic(make([]byte, 17))
+	assert.ErrorIs(t, err, ErrInvalidEntropy)
+}
+
+func TestValidateMnemonic(t *testing.T) {
+	valid := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	assert.NoError(t, ValidateMnemonic(valid))
+	// extra whitespace doesn't change the mnemonic
+	assert.NoError(t, ValidateMnemonic("  "+strings.ReplaceAll(valid, " ", "\n  ")))
+
+	invalid := []string{
+		"",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abouts",
+		"Abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+	}
+	for _, mnemonic := range invalid {
+		assert.ErrorIs(t, ValidateMnemonic(mnemonic), ErrInvalidMnemonic, mnemonic)
+	}
+
+	_, err := MnemonicToSeed(invalid[2], "")
+	assert.ErrorIs(t, err, ErrInvalidMnemonic)
+}
+
+func TestNewPrivateKeyFromMnemonic(t *testing.T) {
+	mnemonic := GenerateMnemonic()
+	path := "m/44'/1'/0'/0'/0'"
+
+	a, err := NewPrivateKeyFromMnemonic(mnemonic, "", path)
+	require.NoError(t, err)
+	b, err := NewPrivateKeyFromMnemonic(mnemonic, "", path)
+	require.NoError(t, err)
+	assert.True(t, a.Equals(b))
+
+	c, err := NewPrivateKeyFromMnemonic(mnemonic, "passphrase", path)
+	require.NoError(t, err)
+	assert.False(t, a.Equals(c))
+
+	seed, err := MnemonicToSeed(mnemonic, "")
+	require.NoError(t, err)
+	master, err := NewMasterKeyFromMnemonic(mnemonic, "")
+	require.NoError(t, err)
+	root, err := NewMasterKey(seed)
+	require.NoError(t, err)
+	assert.True(t, master.PrivateKey().Equals(root.PrivateKey()))
+}
@@ -0,0 +1,201 @@
+// Package gcs implements Golomb-coded sets, compact probabilistic filters
+// that tell whether an item may be in a set without listing its items.
+package gcs
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// P is the number of bits of the remainder of the Golomb-Rice coding.
+	P = 19
+	// M is the inverse of the false positive rate, 1/M is about 1/2^P.
+	M = 784931
+	// KeyLen is the length of the key the items are hashed with.
+	KeyLen = 16
+)
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Filter is a Golomb-coded set. Its items are hashed with a key, usually
+// derived from the block the filter is about, so that filters of different
+// blocks don't share false positives.
+type Filter struct {
+	n    uint64
+	data []byte
+}
+
+// Build returns the filter of items keyed with key. Duplicates are only
+// counted once.
+func Build(key [KeyLen]byte, items [][]byte) *Filter {
+	seen := make(map[string]struct{}, len(items))
+	unique := make([][]byte, 0, len(items))
+	for _, item := range items {
+		if _, ok := seen[string(item)]; ok {
+			continue
+		}
+		seen[string(item)] = struct{}{}
+		unique = append(unique, item)
+	}
+
+	var (
+		n      = uint64(len(unique))
+		values = make([]uint64, 0, n)
+		k0, k1 = keys(key)
+	)
+	for _, item := range unique {
+		values = append(values, hashToRange(k0, k1, item, n*M))
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	w := &bitWriter{}
+	prev := uint64(0)
+	for _, v := range values {
+		delta := v - prev
+		prev = v
+		for q := delta >> P; q > 0; q-- {
+			w.writeBit(true)
+		}
+		w.writeBit(false)
+		w.writeBits(delta, P)
+	}
+	return &Filter{n: n, data: w.bytes}
+}
+
+// FromBytes decodes a filter serialized with Bytes.
+func FromBytes(b []byte) (*Filter, error) {
+	n, size := binary.Uvarint(b)
+	if size <= 0 {
+		return nil, ErrInvalidFilter
+	}
+	return &Filter{n: n, data: b[size:]}, nil
+}
+
+// Bytes serializes the filter as the number of items followed by the
+// Golomb-Rice coded deltas of their sorted hashes.
+func (f *Filter) Bytes() []byte {
+	b := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(f.data)), f.n)
+	return append(b, f.data...)
+}
+
+// N returns the number of items of the filter.
+func (f *Filter) N() int {
+	return int(f.n)
+}
+
+// Match reports whether item may be in the filter, false positives happen
+// with a rate of 1/M.
+func (f *Filter) Match(key [KeyLen]byte, item []byte) bool {
+	return f.MatchAny(key, [][]byte{item})
+}
+
+// MatchAny reports whether any of items may be in the filter.
+func (f *Filter) MatchAny(key [KeyLen]byte, items [][]byte) bool {
+	if f.n == 0 || len(items) == 0 {
+		return false
+	}
+	k0, k1 := keys(key)
+	targets := make([]uint64, 0, len(items))
+	for _, item := range items {
+		targets = append(targets, hashToRange(k0, k1, item, f.n*M))
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i] < targets[j] })
+
+	r := &bitReader{data: f.data}
+	value := uint64(0)
+	for i := uint64(0); i < f.n; i++ {
+		delta, ok := r.readDelta()
+		if !ok {
+			return false
+		}
+		value += delta
+		for len(targets) > 0 && targets[0] < value {
+			targets = targets[1:]
+		}
+		if len(targets) == 0 {
+			return false
+		}
+		if targets[0] == value {
+			return true
+		}
+	}
+	return false
+}
+
+func keys(key [KeyLen]byte) (uint64, uint64) {
+	return binary.LittleEndian.Uint64(key[:8]), binary.LittleEndian.Uint64(key[8:])
+}
+
+// hashToRange maps the hash of item uniformly to [0, f).
+func hashToRange(k0, k1 uint64, item []byte, f uint64) uint64 {
+	hi, _ := bits.Mul64(sipHash(k0, k1, item), f)
+	return hi
+}
+
+type bitWriter struct {
+	bytes []byte
+	// used is the number of bits used in the last byte.
+	used uint
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.used == 0 || w.used == 8 {
+		w.bytes = append(w.bytes, 0)
+		w.used = 0
+	}
+	if bit {
+		w.bytes[len(w.bytes)-1] |= 1 << (7 - w.used)
+	}
+	w.used++
+}
+
+// writeBits writes the n low bits of v, most significant first.
+func (w *bitWriter) writeBits(v uint64, n uint) {
+	for i := n; i > 0; i-- {
+		w.writeBit(v&(1<<(i-1)) != 0)
+	}
+}
+
+type bitReader struct {
+	data []byte
+	pos  uint
+}
+
+func (r *bitReader) readBit() (bool, bool) {
+	if r.pos >= uint(len(r.data))*8 {
+		return false, false
+	}
+	bit := r.data[r.pos/8]&(1<<(7-r.pos%8)) != 0
+	r.pos++
+	return bit, true
+}
+
+// readDelta reads a Golomb-Rice coded value.
+func (r *bitReader) readDelta() (uint64, bool) {
+	q := uint64(0)
+	for {
+		bit, ok := r.readBit()
+		if !ok {
+			return 0, false
+		}
+		if !bit {
+			break
+		}
+		q++
+	}
+	rem := uint64(0)
+	for i := 0; i < P; i++ {
+		bit, ok := r.readBit()
+		if !ok {
+			return 0, false
+		}
+		rem <<= 1
+		if bit {
+			rem |= 1
+		}
+	}
+	return q<<P | rem, true
+}
@@ -0,0 +1,76 @@
+package gcs
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSipHashVectors(t *testing.T) {
+	var (
+		k0, k1 = keys([KeyLen]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})
+		msg    = []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14}
+	)
+	// from the SipHash reference implementation
+	assert.Equal(t, uint64(0x726fdb47dd0e0e31), sipHash(k0, k1, msg[:0]))
+	assert.Equal(t, uint64(0x93f5f5799a932462), sipHash(k0, k1, msg[:8]))
+	assert.Equal(t, uint64(0xa129ca6149be45e5), sipHash(k0, k1, msg[:15]))
+}
+
+func randomKey(t *testing.T) [KeyLen]byte {
+	var key [KeyLen]byte
+	_, err := rand.Read(key[:])
+	require.NoError(t, err)
+	return key
+}
+
+func TestFilterMatch(t *testing.T) {
+	var (
+		// a fixed key keeps the false positives below deterministic
+		key   = [KeyLen]byte{42}
+		items = make([][]byte, 0)
+	)
+	for i := 0; i < 100; i++ {
+		items = append(items, []byte(fmt.Sprintf("item-%d", i)))
+	}
+	items = append(items, items[0])
+
+	filter, err := FromBytes(Build(key, items).Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, 100, filter.N())
+	for _, item := range items {
+		assert.True(t, filter.Match(key, item))
+	}
+	assert.True(t, filter.MatchAny(key, [][]byte{[]byte("missing"), items[50]}))
+
+	// a false positive is a 1 in M event
+	misses := 0
+	for i := 0; i < 1000; i++ {
+		if !filter.Match(key, []byte(fmt.Sprintf("missing-%d", i))) {
+			misses++
+		}
+	}
+	assert.Equal(t, 1000, misses)
+	assert.False(t, filter.Match([KeyLen]byte{43}, items[0]))
+}
+
+func TestEmptyFilter(t *testing.T) {
+	key := randomKey(t)
+	filter := Build(key, nil)
+	assert.Equal(t, []byte{0}, filter.Bytes())
+	assert.False(t, filter.Match(key, []byte("item")))
+
+	_, err := FromBytes(nil)
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+}
+
+func TestTruncatedFilterDoesntMatch(t *testing.T) {
+	key := randomKey(t)
+	b := Build(key, [][]byte{[]byte("a"), []byte("b"), []byte("c")}).Bytes()
+	filter, err := FromBytes(b[:2])
+	require.NoError(t, err)
+	assert.False(t, filter.Match(key, []byte("c")))
+}
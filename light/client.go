@@ -0,0 +1,394 @@
+// Package light implements a client that follows the chain through the
+// block headers only and relies on Merkle proofs from full nodes to confirm
+// the transactions it cares about.
+package light
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/node"
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/types"
+)
+
+// headersBatch is the number of headers asked for at once.
+const headersBatch = 500
+
+var (
+	ErrInvalidHeader   = errors.New("invalid header")
+	ErrUnknownProposer = errors.New("header proposed by an unknown validator")
+	ErrInvalidProof    = errors.New("invalid merkle proof")
+	ErrInvalidFilter   = errors.New("invalid block filter")
+)
+
+// Config configures a light client.
+type Config struct {
+	// Genesis is the trusted first block of the chain.
+	Genesis *proto.Block
+	// Validators are the public keys allowed to propose blocks, the
+	// proposer of the genesis when empty.
+	Validators [][]byte
+}
+
+// Confirmation is a transaction proven to be included in the chain.
+type Confirmation struct {
+	Transaction *proto.Transaction
+	BlockHash   []byte
+	Height      int
+	// Confirmations counts the including block and the ones on top of it,
+	// as of the headers synced when the confirmation was returned.
+	Confirmations int
+}
+
+// Client syncs and validates the headers served by a full node, and
+// confirms the transactions touching the watched addresses.
+type Client struct {
+	query      proto.QueryClient
+	validators map[string]bool
+
+	lock    sync.RWMutex
+	headers *node.HeaderList
+	// filterHeaders are the filter headers of the synced headers, by
+	// height, computed from the filter hashes they commit to.
+	filterHeaders [][]byte
+	// watched are the hex encoded addresses, confirmed the transactions
+	// touching them by hex encoded hash.
+	watched   map[string][]byte
+	confirmed map[string]*Confirmation
+}
+
+func NewClient(query proto.QueryClient, cfg Config) (*Client, error) {
+	if cfg.Genesis == nil || cfg.Genesis.Header == nil || cfg.Genesis.Header.Height != 0 {
+		return nil, fmt.Errorf("%w: missing genesis", ErrInvalidHeader)
+	}
+	c := &Client{
+		query:      query,
+		validators: make(map[string]bool),
+		headers:    node.NewHeaderList(),
+		watched:    make(map[string][]byte),
+		confirmed:  make(map[string]*Confirmation),
+	}
+	validators := cfg.Validators
+	if len(validators) == 0 {
+		validators = [][]byte{cfg.Genesis.Header.Proposer}
+	}
+	for _, pubKey := range validators {
+		if len(pubKey) != crypto.PubKeyLen {
+			return nil, fmt.Errorf("invalid validator public key length %d", len(pubKey))
+		}
+		c.validators[string(pubKey)] = true
+	}
+	c.addFilterHeader(cfg.Genesis.Header)
+	c.headers.Add(cfg.Genesis.Header)
+	return c, nil
+}
+
+// Height returns the height of the last synced header.
+func (c *Client) Height() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.headers.Height()
+}
+
+// Header returns the synced header at height.
+func (c *Client) Header(height int) (*proto.Header, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if height < 0 || height > c.headers.Height() {
+		return nil, fmt.Errorf("no header at height %d", height)
+	}
+	return c.headers.Get(height), nil
+}
+
+// SyncHeaders fetches the headers on top of the synced ones until the full
+// node has no more, and returns how many were added.
+func (c *Client) SyncHeaders(ctx context.Context) (int, error) {
+	added := 0
+	for {
+		resp, err := c.query.GetHeaders(ctx, &proto.HeadersRequest{
+			FromHeight: int32(c.Height() + 1),
+			Limit:      headersBatch,
+		})
+		if err != nil {
+			return added, err
+		}
+		for _, h := range resp.Headers {
+			if err := c.addHeader(h); err != nil {
+				return added, err
+			}
+			added++
+		}
+		if len(resp.Headers) < headersBatch {
+			return added, nil
+		}
+	}
+}
+
+func (c *Client) addHeader(h *proto.SignedHeader) error {
+	if !types.VerifySignedHeader(h) {
+		return fmt.Errorf("%w: bad signature", ErrInvalidHeader)
+	}
+	if !c.validators[string(h.PublicKey)] {
+		return fmt.Errorf("%w: %x", ErrUnknownProposer, h.PublicKey)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	tip := c.headers.Get(c.headers.Height())
+	if !bytes.Equal(h.Header.PrevHash, types.HashHeader(tip)) {
+		return fmt.Errorf("%w: %v", ErrInvalidHeader, node.ErrInvalidPrevHash)
+	}
+	if err := c.headers.ValidateNext(h.Header); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+	c.addFilterHeader(h.Header)
+	c.headers.Add(h.Header)
+	return nil
+}
+
+// addFilterHeader chains the filter hash h commits to to the last filter
+// header.
+func (c *Client) addFilterHeader(h *proto.Header) {
+	prev := make([]byte, sha256.Size)
+	if len(c.filterHeaders) > 0 {
+		prev = c.filterHeaders[len(c.filterHeaders)-1]
+	}
+	c.filterHeaders = append(c.filterHeaders, types.NextFilterHeader(h.FilterHash, prev))
+}
+
+// GetFilters fetches the filters of up to limit synced blocks starting at
+// height from. Every filter has to hash to the one the header of its block
+// commits to, and the filter headers served along have to match the ones
+// computed from the synced headers.
+func (c *Client) GetFilters(ctx context.Context, from, limit int) ([]*proto.BlockFilter, error) {
+	if from < 0 || from > c.Height() {
+		return nil, fmt.Errorf("no header at height %d", from)
+	}
+	req := &proto.FilterRequest{FromHeight: int32(from), Limit: uint32(limit)}
+	filterHeaders, err := c.query.GetFilterHeaders(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.query.GetFilters(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if err := c.checkFilterHeaders(from, filterHeaders); err != nil {
+		return nil, err
+	}
+	filters := make([]*proto.BlockFilter, 0, len(resp.Filters))
+	for i, f := range resp.Filters {
+		height := from + i
+		if height > c.headers.Height() || (limit > 0 && i >= limit) {
+			break
+		}
+		header := c.headers.Get(height)
+		if int(f.Height) != height || !bytes.Equal(f.BlockHash, types.HashHeader(header)) {
+			return nil, fmt.Errorf("%w: got block %x for height %d", ErrInvalidFilter, f.BlockHash, height)
+		}
+		if !bytes.Equal(types.HashFilter(f.Filter), header.FilterHash) {
+			return nil, fmt.Errorf("%w: filter of block %d doesn't match its header", ErrInvalidFilter, height)
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// checkFilterHeaders checks the filter headers served from height from
+// against the ones computed from the synced headers, past which they are
+// ignored.
+func (c *Client) checkFilterHeaders(from int, resp *proto.FilterHeaders) error {
+	prev := make([]byte, sha256.Size)
+	if from > 0 {
+		prev = c.filterHeaders[from-1]
+	}
+	if !bytes.Equal(resp.PrevHeader, prev) {
+		return fmt.Errorf("%w: filter header before height %d doesn't match", ErrInvalidFilter, from)
+	}
+	for i, header := range resp.Headers {
+		height := from + i
+		if height >= len(c.filterHeaders) {
+			break
+		}
+		if !bytes.Equal(header, c.filterHeaders[height]) {
+			return fmt.Errorf("%w: filter header at height %d doesn't match", ErrInvalidFilter, height)
+		}
+	}
+	return nil
+}
+
+// Watch adds an address whose transactions SyncTransactions confirms.
+func (c *Client) Watch(address []byte) error {
+	if len(address) != crypto.AddressLen {
+		return fmt.Errorf("invalid address length %d", len(address))
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.watched[hex.EncodeToString(address)] = address
+	return nil
+}
+
+// SyncTransactions looks up the transactions touching the watched
+// addresses and returns the ones newly proven to be included in a synced
+// header. The ones in blocks past the synced headers are left for a later
+// sync.
+func (c *Client) SyncTransactions(ctx context.Context) ([]*Confirmation, error) {
+	c.lock.RLock()
+	addresses := make([][]byte, 0, len(c.watched))
+	for _, address := range c.watched {
+		addresses = append(addresses, address)
+	}
+	c.lock.RUnlock()
+
+	confirmations := make([]*Confirmation, 0)
+	for _, address := range addresses {
+		hashes, err := c.addressTxs(ctx, address)
+		if err != nil {
+			return confirmations, err
+		}
+		for _, hash := range hashes {
+			if c.isConfirmed(hash) {
+				continue
+			}
+			conf, err := c.ConfirmTransaction(ctx, hash)
+			if errors.Is(err, errNotSynced) {
+				continue
+			}
+			if err != nil {
+				return confirmations, err
+			}
+			confirmations = append(confirmations, conf)
+		}
+	}
+	return confirmations, nil
+}
+
+func (c *Client) addressTxs(ctx context.Context, address []byte) ([][]byte, error) {
+	hashes := make([][]byte, 0)
+	for {
+		resp, err := c.query.GetAddressTxs(ctx, &proto.AddressRequest{
+			Address: address,
+			Offset:  uint32(len(hashes)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range resp.Transactions {
+			hashes = append(hashes, types.HashTransaction(tx))
+		}
+		if len(resp.Transactions) == 0 || len(hashes) >= int(resp.Total) {
+			return hashes, nil
+		}
+	}
+}
+
+func (c *Client) isConfirmed(hash []byte) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	_, ok := c.confirmed[hex.EncodeToString(hash)]
+	return ok
+}
+
+// errNotSynced is returned for transactions in blocks past the synced
+// headers.
+var errNotSynced = errors.New("block of the transaction isn't synced yet")
+
+// ConfirmTransaction asks a full node where the transaction with the given
+// hash is and checks its Merkle proof against the synced header of that
+// block.
+func (c *Client) ConfirmTransaction(ctx context.Context, hash []byte) (*Confirmation, error) {
+	info, err := c.query.GetTransaction(ctx, &proto.HashRequest{Hash: hash})
+	if err != nil {
+		return nil, err
+	}
+	if info.Pending {
+		return nil, errNotSynced
+	}
+	if info.Transaction == nil || !bytes.Equal(types.HashTransaction(info.Transaction), hash) {
+		return nil, fmt.Errorf("%w: got another transaction", ErrInvalidProof)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	height := int(info.Height)
+	if height < 0 {
+		return nil, fmt.Errorf("%w: negative height %d", ErrInvalidProof, height)
+	}
+	if height > c.headers.Height() {
+		return nil, errNotSynced
+	}
+	header := c.headers.Get(height)
+	if !bytes.Equal(types.HashHeader(header), info.BlockHash) {
+		return nil, fmt.Errorf("%w: block %x isn't the synced one at height %d", ErrInvalidProof, info.BlockHash, height)
+	}
+	if !types.VerifyTxInclusion(header, info.Transaction, info.Proof) {
+		return nil, ErrInvalidProof
+	}
+	conf := &Confirmation{
+		Transaction: info.Transaction,
+		BlockHash:   info.BlockHash,
+		Height:      height,
+	}
+	c.confirmed[hex.EncodeToString(hash)] = conf
+	return c.withDepth(conf), nil
+}
+
+// Confirmed returns the confirmed transactions touching the watched
+// addresses.
+func (c *Client) Confirmed() []*Confirmation {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	confirmations := make([]*Confirmation, 0, len(c.confirmed))
+	for _, conf := range c.confirmed {
+		confirmations = append(confirmations, c.withDepth(conf))
+	}
+	return confirmations
+}
+
+// withDepth returns a copy of conf with the confirmations as of the synced
+// headers.
+func (c *Client) withDepth(conf *Confirmation) *Confirmation {
+	cp := *conf
+	cp.Confirmations = c.headers.Height() - conf.Height + 1
+	return &cp
+}
+
+// Sync syncs the headers, then the transactions of the watched addresses.
+func (c *Client) Sync(ctx context.Context) ([]*Confirmation, error) {
+	if _, err := c.SyncHeaders(ctx); err != nil {
+		return nil, err
+	}
+	return c.SyncTransactions(ctx)
+}
+
+// Run syncs every interval until ctx is done, passing the new
+// confirmations to handle.
+func (c *Client) Run(ctx context.Context, interval time.Duration, handle func(*Confirmation)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		confirmations, err := c.Sync(ctx)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		for _, conf := range confirmations {
+			handle(conf)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
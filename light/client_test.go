@@ -0,0 +1,252 @@
+package light
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/gcs"
+	"github.com/vazj/blocker/node"
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/types"
+	"github.com/vazj/blocker/util"
+	"google.golang.org/grpc"
+)
+
+// fakeQuery serves the queries of the light client from a chain.
+type fakeQuery struct {
+	proto.QueryClient
+	chain *node.Chain
+	// tamperFilters, when set, changes the filters and filter headers
+	// served, as a lying full node would.
+	tamperFilters func(*proto.BlockFilters, *proto.FilterHeaders)
+}
+
+func (q *fakeQuery) filters(req *proto.FilterRequest) (*proto.BlockFilters, *proto.FilterHeaders, error) {
+	filters, err := q.chain.GetBlockFilters(int(req.FromHeight), int(req.Limit))
+	if err != nil {
+		return nil, nil, err
+	}
+	headers, prevHeader, err := q.chain.GetFilterHeaders(int(req.FromHeight), int(req.Limit))
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		blockFilters  = &proto.BlockFilters{Filters: filters}
+		filterHeaders = &proto.FilterHeaders{Headers: headers, PrevHeader: prevHeader}
+	)
+	if q.tamperFilters != nil {
+		q.tamperFilters(blockFilters, filterHeaders)
+	}
+	return blockFilters, filterHeaders, nil
+}
+
+func (q *fakeQuery) GetFilters(ctx context.Context, req *proto.FilterRequest, _ ...grpc.CallOption) (*proto.BlockFilters, error) {
+	filters, _, err := q.filters(req)
+	return filters, err
+}
+
+func (q *fakeQuery) GetFilterHeaders(ctx context.Context, req *proto.FilterRequest, _ ...grpc.CallOption) (*proto.FilterHeaders, error) {
+	_, headers, err := q.filters(req)
+	return headers, err
+}
+
+func (q *fakeQuery) GetHeaders(ctx context.Context, req *proto.HeadersRequest, _ ...grpc.CallOption) (*proto.SignedHeaders, error) {
+	headers, err := q.chain.GetSignedHeaders(int(req.FromHeight), int(req.Limit))
+	if err != nil {
+		return nil, err
+	}
+	return &proto.SignedHeaders{Headers: headers}, nil
+}
+
+func (q *fakeQuery) GetAddressTxs(ctx context.Context, req *proto.AddressRequest, _ ...grpc.CallOption) (*proto.AddressTxs, error) {
+	txs, total, err := q.chain.GetAddressTxs(req.Address, int(req.Offset), 100)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.AddressTxs{Transactions: txs, Total: uint32(total)}, nil
+}
+
+func (q *fakeQuery) GetTransaction(ctx context.Context, req *proto.HashRequest, _ ...grpc.CallOption) (*proto.TransactionInfo, error) {
+	return q.chain.GetTransactionInfo(req.Hash)
+}
+
+type testChain struct {
+	chain     *node.Chain
+	genesis   *proto.Block
+	validator *crypto.PrivateKey
+	owner     *crypto.PrivateKey
+}
+
+func newTestChain(t *testing.T) *testChain {
+	var (
+		validator = crypto.GeneratePrivateKey()
+		owner     = crypto.GeneratePrivateKey()
+		genesis   = node.NewGenesisBlock(validator, time.Now().Add(-time.Minute).UnixNano(), []node.GenesisAlloc{
+			{Address: owner.Public().Address().Bytes(), Amount: 1000},
+		})
+	)
+	return &testChain{
+		chain:     node.NewChainWithGenesis(genesis, node.DefaultConsensusParams(), node.NewMemoryBlockStore(), node.NewMemoryTXStore()),
+		genesis:   genesis,
+		validator: validator,
+		owner:     owner,
+	}
+}
+
+// addBlock adds a block with txx on top of the chain, signed by key.
+func (c *testChain) addBlock(t *testing.T, key *crypto.PrivateKey, txx ...*proto.Transaction) *proto.Block {
+	tip, err := c.chain.Tip()
+	require.NoError(t, err)
+	block := util.RandomBlockAfter(tip.Header, types.HashBlock(tip))
+	block.Transactions = txx
+	types.SignBlock(key, block)
+	require.NoError(t, c.chain.AddBlock(block))
+	return block
+}
+
+// pay sends amount from the genesis allocation to recipient.
+func (c *testChain) pay(recipient []byte, amount int64) *proto.Transaction {
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash: types.HashTransaction(c.genesis.Transactions[0]),
+			PublicKey:  c.owner.Public().Bytes(),
+		}},
+		Outputs: []*proto.TxOutput{
+			{Amount: amount, Address: recipient},
+			{Amount: 1000 - amount, Address: c.owner.Public().Address().Bytes()},
+		},
+	}
+	tx.Inputs[0].Signature = types.SignTransaction(c.owner, tx).Bytes()
+	return tx
+}
+
+func TestSyncHeadersAndConfirmPayments(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		tc        = newTestChain(t)
+		recipient = crypto.GeneratePrivateKey().Public().Address().Bytes()
+	)
+	client, err := NewClient(&fakeQuery{chain: tc.chain}, Config{
+		Genesis:    tc.genesis,
+		Validators: [][]byte{tc.validator.Public().Bytes()},
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Watch(recipient))
+
+	payment := tc.pay(recipient, 100)
+	tc.addBlock(t, tc.validator, payment)
+	tc.addBlock(t, tc.validator)
+
+	confirmations, err := client.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, client.Height())
+	require.Len(t, confirmations, 1)
+	assert.Equal(t, types.HashTransaction(payment), types.HashTransaction(confirmations[0].Transaction))
+	assert.Equal(t, 1, confirmations[0].Height)
+	assert.Equal(t, 2, confirmations[0].Confirmations)
+
+	// already confirmed transactions aren't returned again
+	tc.addBlock(t, tc.validator)
+	confirmations, err = client.Sync(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, confirmations)
+	confirmed := client.Confirmed()
+	require.Len(t, confirmed, 1)
+	assert.Equal(t, 3, confirmed[0].Confirmations)
+}
+
+func TestSyncHeadersRejectsUnknownProposer(t *testing.T) {
+	tc := newTestChain(t)
+	client, err := NewClient(&fakeQuery{chain: tc.chain}, Config{
+		Genesis:    tc.genesis,
+		Validators: [][]byte{tc.validator.Public().Bytes()},
+	})
+	require.NoError(t, err)
+
+	tc.addBlock(t, tc.validator)
+	tc.addBlock(t, crypto.GeneratePrivateKey())
+
+	added, err := client.SyncHeaders(context.Background())
+	assert.ErrorIs(t, err, ErrUnknownProposer)
+	assert.Equal(t, 1, added)
+	assert.Equal(t, 1, client.Height())
+}
+
+func TestSyncHeadersDefaultsToGenesisProposer(t *testing.T) {
+	tc := newTestChain(t)
+	client, err := NewClient(&fakeQuery{chain: tc.chain}, Config{Genesis: tc.genesis})
+	require.NoError(t, err)
+
+	tc.addBlock(t, tc.validator)
+	tc.addBlock(t, crypto.GeneratePrivateKey())
+
+	added, err := client.SyncHeaders(context.Background())
+	assert.ErrorIs(t, err, ErrUnknownProposer)
+	assert.Equal(t, 1, added)
+	assert.Equal(t, 1, client.Height())
+}
+
+func TestSyncHeadersRejectsForeignChain(t *testing.T) {
+	tc := newTestChain(t)
+	client, err := NewClient(&fakeQuery{chain: tc.chain}, Config{
+		Genesis:    newTestChain(t).genesis,
+		Validators: [][]byte{tc.validator.Public().Bytes()},
+	})
+	require.NoError(t, err)
+
+	tc.addBlock(t, tc.validator)
+	_, err = client.SyncHeaders(context.Background())
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+	assert.Equal(t, 0, client.Height())
+}
+
+func TestGetFilters(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		tc        = newTestChain(t)
+		query     = &fakeQuery{chain: tc.chain}
+		recipient = crypto.GeneratePrivateKey().Public().Address().Bytes()
+	)
+	client, err := NewClient(query, Config{
+		Genesis:    tc.genesis,
+		Validators: [][]byte{tc.validator.Public().Bytes()},
+	})
+	require.NoError(t, err)
+	block := tc.addBlock(t, tc.validator, tc.pay(recipient, 100))
+	tc.addBlock(t, tc.validator)
+	_, err = client.SyncHeaders(ctx)
+	require.NoError(t, err)
+
+	filters, err := client.GetFilters(ctx, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, filters, 2)
+	filter, err := gcs.FromBytes(filters[0].Filter)
+	require.NoError(t, err)
+	assert.True(t, filter.Match(types.FilterKey(block.Header.PrevHash), recipient))
+
+	// a full node hiding the payment behind a consistent chain of filters
+	query.tamperFilters = func(filters *proto.BlockFilters, headers *proto.FilterHeaders) {
+		prev := headers.PrevHeader
+		for i, f := range filters.Filters {
+			if f.Height == 1 {
+				f.Filter = gcs.Build(types.FilterKey(block.Header.PrevHash), nil).Bytes()
+			}
+			headers.Headers[i] = types.FilterHeader(f.Filter, prev)
+			prev = headers.Headers[i]
+		}
+	}
+	_, err = client.GetFilters(ctx, 1, 10)
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+
+	// or serving filter headers that don't match the synced headers
+	query.tamperFilters = func(_ *proto.BlockFilters, headers *proto.FilterHeaders) {
+		headers.Headers[1] = make([]byte, 32)
+	}
+	_, err = client.GetFilters(ctx, 0, 10)
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+}
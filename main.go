@@ -1,74 +1,63 @@
 package main
 
 import (
-	"context"
-	"log"
-	"time"
-
-	"github.com/vazj/blocker/crypto"
-	"github.com/vazj/blocker/node"
-	"github.com/vazj/blocker/proto"
-	"github.com/vazj/blocker/util"
-	"google.golang.org/grpc"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 )
 
-func main() {
-	makeNode(":3000", []string{}, true)
-	time.Sleep(time.Second)
-	makeNode(":4000", []string{":3000"}, false)
-	time.Sleep(time.Second)
-	makeNode(":6000", []string{":4000"}, false)
-	for {
-		time.Sleep(time.Second)
-		makeTransaction()
-	}
-}
-
-func makeNode(listenAddr string, bootstrapNodes []string, isValidator bool) *node.Node {
-	cfg := node.ServerConfig{
-		Version:    "Blocker-1",
-		ListenAddr: listenAddr,
-	}
+const usage = `usage: blocker <command> [flags]
 
-	if isValidator {
-		cfg.PrivateKey = crypto.GeneratePrivateKey()
-	}
+commands:
+  node start      run a node
+  keygen          generate a key pair
+  genesis init    create the genesis block of a new chain
+  wallet new      add a key to the wallet
+  wallet mnemonic generate a 24 word mnemonic to restore keys from
+  wallet restore  add the keys of a mnemonic to the wallet
+  wallet list     list the wallet addresses
+  wallet balance  show the balance of the wallet addresses
+  wallet send     send coins from the wallet
 
-	n := node.NewNode(cfg)
-	go n.Start(listenAddr, bootstrapNodes)
+Run "blocker <command> -h" for the flags of a command.
+`
 
-	return n
-}
+var errUsage = errors.New("invalid usage")
 
-func makeTransaction() {
-	client, err := grpc.Dial("localhost:3000", grpc.WithInsecure())
-	if err != nil {
-		log.Fatal(err)
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprint(os.Stderr, usage)
+		} else {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+		os.Exit(1)
 	}
+}
 
-	c := proto.NewNodeClient(client)
-	privKey := crypto.GeneratePrivateKey()
-	pubKey := privKey.PublicKey()
-
-	tx := &proto.Transaction{
-		Version: 1,
-		Inputs: []*proto.TxInput{
-			{
-				PrevTxHash:   util.RandomHash(),
-				PrevOutIndex: 0,
-				PublicKey:    pubKey.Bytes(),
-			},
-		},
-		Outputs: []*proto.TxOutput{
-			{
-				Amount:  99,
-				Address: pubKey.Address().Bytes(),
-			},
-		},
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
 	}
-
-	_, err = c.HandleTransaction(context.TODO(), tx)
-	if err != nil {
-		log.Fatal(err)
+	switch args[0] {
+	case "node":
+		if len(args) < 2 || args[1] != "start" {
+			return errUsage
+		}
+		return runNodeStart(args[2:], out)
+	case "keygen":
+		return runKeygen(args[1:], out)
+	case "genesis":
+		if len(args) < 2 || args[1] != "init" {
+			return errUsage
+		}
+		return runGenesisInit(args[2:], out)
+	case "wallet":
+		return runWallet(args[1:], out)
+	case "help", "-h", "--help":
+		fmt.Fprint(out, usage)
+		return nil
 	}
+	return errUsage
 }
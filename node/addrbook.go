@@ -0,0 +1,300 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// maxAddrAttempts is the number of failed dials in a row after which an
+	// address is dropped from the book.
+	maxAddrAttempts = 10
+	// addrRetryInterval is the base delay before dialing an address that
+	// failed again, doubled for every failed attempt.
+	addrRetryInterval = 10 * time.Second
+	// maxPeersPerGroup is the number of outbound peers we connect to from
+	// the same subnet, so a single operator can't easily surround us.
+	maxPeersPerGroup = 2
+	// maxAddrBookSize bounds the number of addresses in the book, the worst
+	// ones being evicted to make room for new ones.
+	maxAddrBookSize = 2000
+)
+
+// KnownAddress is an address in the book along with its dial history.
+type KnownAddress struct {
+	Addr        string    `json:"addr"`
+	LastSeen    time.Time `json:"lastSeen"`
+	LastAttempt time.Time `json:"lastAttempt"`
+	Attempts    int       `json:"attempts"`
+}
+
+// retryAt returns when the address may be dialed again.
+func (ka *KnownAddress) retryAt() time.Time {
+	if ka.Attempts == 0 {
+		return ka.LastAttempt
+	}
+	return ka.LastAttempt.Add(addrRetryInterval << (ka.Attempts - 1))
+}
+
+// AddrBook keeps track of the addresses of the nodes we know about. It is
+// persisted to disk so we don't depend on bootstrap nodes after a restart.
+type AddrBook struct {
+	lock  sync.RWMutex
+	path  string
+	addrs map[string]*KnownAddress
+}
+
+// NewAddrBook returns an empty address book stored at path. An empty path
+// keeps the book in memory only.
+func NewAddrBook(path string) *AddrBook {
+	return &AddrBook{
+		path:  path,
+		addrs: make(map[string]*KnownAddress),
+	}
+}
+
+// Load reads the addresses saved at the book's path, if any.
+func (b *AddrBook) Load() error {
+	if b.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var addrs []*KnownAddress
+	if err := json.Unmarshal(data, &addrs); err != nil {
+		return err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, ka := range addrs {
+		b.addrs[ka.Addr] = ka
+	}
+	return nil
+}
+
+// Save writes the book to its path.
+func (b *AddrBook) Save() error {
+	if b.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(b.List(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(b.path), 0700); err != nil {
+		return err
+	}
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// Add inserts addr in the book and returns false if it was already known
+// or isn't a valid host:port address.
+func (b *AddrBook) Add(addr string) bool {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return false
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if _, ok := b.addrs[addr]; ok {
+		return false
+	}
+	b.insert(&KnownAddress{Addr: addr})
+	return true
+}
+
+// insert adds ka to the book, evicting the worst address when it is full.
+func (b *AddrBook) insert(ka *KnownAddress) {
+	if len(b.addrs) >= maxAddrBookSize {
+		b.evict()
+	}
+	b.addrs[ka.Addr] = ka
+}
+
+// evict drops the address that failed the most dials in a row, the one
+// seen the longest ago among them.
+func (b *AddrBook) evict() {
+	var worst *KnownAddress
+	for _, ka := range b.addrs {
+		if worst == nil || ka.Attempts > worst.Attempts ||
+			(ka.Attempts == worst.Attempts && ka.LastSeen.Before(worst.LastSeen)) {
+			worst = ka
+		}
+	}
+	if worst != nil {
+		delete(b.addrs, worst.Addr)
+	}
+}
+
+func (b *AddrBook) Has(addr string) bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	_, ok := b.addrs[addr]
+	return ok
+}
+
+// MarkAttempt records a failed dial, dropping the address once it failed
+// too many times in a row.
+func (b *AddrBook) MarkAttempt(addr string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	ka, ok := b.addrs[addr]
+	if !ok {
+		return
+	}
+	ka.LastAttempt = time.Now()
+	ka.Attempts++
+	if ka.Attempts >= maxAddrAttempts {
+		delete(b.addrs, addr)
+	}
+}
+
+// MarkGood records a successful connection to addr.
+func (b *AddrBook) MarkGood(addr string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	ka, ok := b.addrs[addr]
+	if !ok {
+		ka = &KnownAddress{Addr: addr}
+		b.insert(ka)
+	}
+	now := time.Now()
+	ka.LastSeen = now
+	ka.LastAttempt = now
+	ka.Attempts = 0
+}
+
+func (b *AddrBook) Remove(addr string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.addrs, addr)
+}
+
+func (b *AddrBook) Len() int {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return len(b.addrs)
+}
+
+func (b *AddrBook) List() []*KnownAddress {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	addrs := make([]*KnownAddress, 0, len(b.addrs))
+	for _, ka := range b.addrs {
+		kaCopy := *ka
+		addrs = append(addrs, &kaCopy)
+	}
+	return addrs
+}
+
+// Sample returns up to n random addresses of the book.
+func (b *AddrBook) Sample(n int) []string {
+	addrs := b.List()
+	rand.Shuffle(len(addrs), func(i, j int) { addrs[i], addrs[j] = addrs[j], addrs[i] })
+	if len(addrs) > n {
+		addrs = addrs[:n]
+	}
+	sample := make([]string, len(addrs))
+	for i, ka := range addrs {
+		sample[i] = ka.Addr
+	}
+	return sample
+}
+
+// Select picks up to n random addresses that are due for a dial attempt.
+// Addresses for which skip returns true are ignored and no more than
+// maxPeersPerGroup addresses are picked per subnet, taking into account the
+// addresses we are already connected to.
+func (b *AddrBook) Select(n int, connected []string, skip func(string) bool) []string {
+	groups := make(map[string]int)
+	for _, addr := range connected {
+		groups[addrGroup(addr)]++
+	}
+
+	var (
+		now        = time.Now()
+		candidates = b.List()
+		selected   = make([]string, 0, n)
+	)
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	for _, ka := range candidates {
+		if len(selected) >= n {
+			break
+		}
+		if now.Before(ka.retryAt()) || skip(ka.Addr) {
+			continue
+		}
+		group := addrGroup(ka.Addr)
+		if groups[group] >= maxPeersPerGroup {
+			continue
+		}
+		groups[group]++
+		selected = append(selected, ka.Addr)
+	}
+	return selected
+}
+
+// isIPAddr tells whether addr is an IP literal along with a port. The
+// addresses learned from peers have to be, a host name would get a group of
+// its own and let a single operator get around maxPeersPerGroup.
+func isIPAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	return err == nil && net.ParseIP(host) != nil
+}
+
+// resolveAddr fills in the host of addr, an address a peer advertised,
+// when it has none or an unspecified one, as a node listening on all of its
+// interfaces with ":3000" does. host is where the peer was reached from.
+func resolveAddr(addr, host string) string {
+	addrHost, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return addr
+	}
+	if ip := net.ParseIP(addrHost); addrHost != "" && (ip == nil || !ip.IsUnspecified()) {
+		return addr
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// hostOf returns the host of addr, empty when it has none.
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// addrGroup returns the subnet an address belongs to: the /16 for IPv4 and
+// the /32 for IPv6. Local and unresolved addresses form a group of their
+// own so local test networks are not limited.
+func addrGroup(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() {
+		return addr
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(16, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(32, 128)).String()
+}
@@ -0,0 +1,181 @@
+package node
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddrBookAdd(t *testing.T) {
+	b := NewAddrBook("")
+	assert.True(t, b.Add("10.0.0.1:3000"))
+	assert.False(t, b.Add("10.0.0.1:3000"))
+	assert.False(t, b.Add("not an address"))
+	assert.True(t, b.Has("10.0.0.1:3000"))
+	assert.Equal(t, 1, b.Len())
+}
+
+func TestAddrBookBounded(t *testing.T) {
+	b := NewAddrBook("")
+	b.MarkGood("10.0.0.1:3000")
+	b.Add("10.0.0.2:3000")
+	b.MarkAttempt("10.0.0.2:3000")
+	for i := 0; b.Len() < maxAddrBookSize; i++ {
+		b.Add(fmt.Sprintf("10.1.%d.%d:3000", i/256, i%256))
+	}
+
+	// the failing address goes first, the good one stays
+	assert.True(t, b.Add("10.2.0.1:3000"))
+	assert.Equal(t, maxAddrBookSize, b.Len())
+	assert.False(t, b.Has("10.0.0.2:3000"))
+	for i := 0; i < maxAddrBookSize; i++ {
+		b.Add(fmt.Sprintf("10.3.%d.%d:3000", i/256, i%256))
+	}
+	assert.Equal(t, maxAddrBookSize, b.Len())
+	assert.True(t, b.Has("10.0.0.1:3000"))
+}
+
+func TestAddAddrs(t *testing.T) {
+	n := NewNode(ServerConfig{ListenAddr: "10.0.0.1:3000"})
+	addrs := []string{"10.0.0.1:3000", "10.0.0.2:3000", "example.com:3000", "[2001:db8::1]:3000", ":4000", "0.0.0.0:5000"}
+	for i := 0; i < 2*maxGetPeersAddrs; i++ {
+		addrs = append(addrs, fmt.Sprintf("10.1.%d.%d:3000", i/256, i%256))
+	}
+	n.addAddrs("10.0.0.9", addrs)
+
+	// only the IP literals of the first batch, but our own address
+	assert.Equal(t, maxGetPeersAddrs-2, n.addrBook.Len())
+	assert.True(t, n.addrBook.Has("10.0.0.2:3000"))
+	assert.True(t, n.addrBook.Has("[2001:db8::1]:3000"))
+	assert.False(t, n.addrBook.Has("example.com:3000"))
+	assert.False(t, n.addrBook.Has("10.0.0.1:3000"))
+	// addresses without a host are on the machine of the sender
+	assert.True(t, n.addrBook.Has("10.0.0.9:4000"))
+	assert.True(t, n.addrBook.Has("10.0.0.9:5000"))
+	assert.False(t, n.addrBook.Has(":4000"))
+}
+
+func TestAddrBookMarkAttempt(t *testing.T) {
+	var (
+		b    = NewAddrBook("")
+		addr = "10.0.0.1:3000"
+	)
+	b.Add(addr)
+	assert.Equal(t, []string{addr}, b.Select(1, nil, func(string) bool { return false }))
+
+	// a failed address has to wait before it can be selected again
+	b.MarkAttempt(addr)
+	assert.Empty(t, b.Select(1, nil, func(string) bool { return false }))
+
+	b.MarkGood(addr)
+	assert.Equal(t, []string{addr}, b.Select(1, nil, func(string) bool { return false }))
+
+	for i := 0; i < maxAddrAttempts; i++ {
+		b.MarkAttempt(addr)
+	}
+	assert.False(t, b.Has(addr))
+}
+
+func TestAddrBookSelectLimitsGroups(t *testing.T) {
+	b := NewAddrBook("")
+	for _, addr := range []string{
+		"10.0.1.1:3000",
+		"10.0.2.1:3000",
+		"10.0.3.1:3000",
+		"10.1.0.1:3000",
+		"192.168.0.1:3000",
+	} {
+		b.Add(addr)
+	}
+	never := func(string) bool { return false }
+
+	selected := b.Select(10, nil, never)
+	assert.Len(t, selected, 4)
+
+	// we are already connected to a peer in 10.0.0.0/16
+	selected = b.Select(10, []string{"10.0.9.9:3000"}, never)
+	assert.Len(t, selected, 3)
+
+	selected = b.Select(10, nil, func(addr string) bool { return addr == "192.168.0.1:3000" })
+	assert.Len(t, selected, 3)
+	assert.NotContains(t, selected, "192.168.0.1:3000")
+}
+
+func TestAddrGroup(t *testing.T) {
+	assert.Equal(t, "10.0.0.0", addrGroup("10.0.1.1:3000"))
+	assert.Equal(t, addrGroup("10.0.1.1:3000"), addrGroup("10.0.200.7:4000"))
+	assert.NotEqual(t, addrGroup("10.0.1.1:3000"), addrGroup("10.1.1.1:3000"))
+	assert.Equal(t, "2001:db8::", addrGroup("[2001:db8:1::1]:3000"))
+	assert.Equal(t, "127.0.0.1:3000", addrGroup("127.0.0.1:3000"))
+	assert.NotEqual(t, addrGroup("127.0.0.1:3000"), addrGroup("127.0.0.1:4000"))
+	assert.Equal(t, ":3000", addrGroup(":3000"))
+}
+
+func TestResolveAddr(t *testing.T) {
+	assert.Equal(t, "10.0.0.1:3000", resolveAddr(":3000", "10.0.0.1"))
+	assert.Equal(t, "10.0.0.1:3000", resolveAddr("0.0.0.0:3000", "10.0.0.1"))
+	assert.Equal(t, "[2001:db8::1]:3000", resolveAddr("[::]:3000", "2001:db8::1"))
+	assert.Equal(t, "10.0.0.2:3000", resolveAddr("10.0.0.2:3000", "10.0.0.1"))
+	assert.Equal(t, "seed.example:3000", resolveAddr("seed.example:3000", "10.0.0.1"))
+	assert.Equal(t, ":3000", resolveAddr(":3000", ""))
+	assert.Equal(t, "3000", resolveAddr("3000", "10.0.0.1"))
+}
+
+func TestAddrBookPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "addrbook.json")
+	b := NewAddrBook(path)
+	b.Add("10.0.0.1:3000")
+	b.MarkGood("10.0.0.2:3000")
+	b.MarkAttempt("10.0.0.1:3000")
+	require.NoError(t, b.Save())
+
+	loaded := NewAddrBook(path)
+	require.NoError(t, loaded.Load())
+	assert.Equal(t, 2, loaded.Len())
+	for _, ka := range loaded.List() {
+		switch ka.Addr {
+		case "10.0.0.1:3000":
+			assert.Equal(t, 1, ka.Attempts)
+		case "10.0.0.2:3000":
+			assert.WithinDuration(t, time.Now(), ka.LastSeen, time.Minute)
+		default:
+			t.Fatalf("unexpected address %s", ka.Addr)
+		}
+	}
+
+	assert.NoError(t, NewAddrBook(filepath.Join(t.TempDir(), "missing.json")).Load())
+}
+
+func TestPeerExchange(t *testing.T) {
+	nodeA, addrA := startNode(t, ServerConfig{})
+	nodeB, addrB := startNode(t, ServerConfig{}, addrA)
+	require.Eventually(t, func() bool {
+		return connected(nodeA, nodeB)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// C only knows about A and has to learn about B from it
+	nodeC, _ := startNode(t, ServerConfig{}, addrA)
+	require.Eventually(t, func() bool {
+		return connected(nodeC, nodeB)
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.True(t, nodeC.addrBook.Has(addrB))
+}
+
+func TestMaxInboundPeers(t *testing.T) {
+	nodeA, addrA := startNode(t, ServerConfig{MaxInboundPeers: 1, MaxOutboundPeers: 1})
+	nodeB, _ := startNode(t, ServerConfig{MaxOutboundPeers: 1}, addrA)
+	require.Eventually(t, func() bool {
+		return connected(nodeA, nodeB)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	nodeC, _ := startNode(t, ServerConfig{MaxOutboundPeers: 1}, addrA)
+	assert.Never(t, func() bool {
+		_, ok := nodeA.peers.Get(nodeID(nodeC))
+		return ok
+	}, 500*time.Millisecond, 50*time.Millisecond)
+	assert.Equal(t, 1, nodeA.peers.Inbound())
+}
@@ -0,0 +1,186 @@
+package node
+
+import (
+	"encoding/hex"
+	"sync"
+)
+
+// AddrIndexer indexes the unspent outputs paying to an address and the
+// transactions touching it, both in the order they were added.
+type AddrIndexer interface {
+	AddUTXO(address []byte, key string) error
+	RemoveUTXO(address []byte, key string) error
+	// UTXOs returns the keys of up to limit unspent outputs of address,
+	// skipping the first offset ones, and the total number of them.
+	UTXOs(address []byte, offset, limit int) ([]string, int, error)
+	AddTx(address []byte, hash string) error
+	RemoveTx(address []byte, hash string) error
+	// Txs returns the hashes of up to limit transactions touching address,
+	// skipping the first offset ones, and the total number of them.
+	Txs(address []byte, offset, limit int) ([]string, int, error)
+}
+
+// orderedSet is a set of strings that remembers the insertion order.
+// Removed items leave a hole in place, so that removing the oldest ones, as
+// spending outputs does, doesn't shift the others, until holes are the
+// majority and the items get compacted.
+type orderedSet struct {
+	items []string
+	index map[string]int
+	holes int
+}
+
+func newOrderedSet() *orderedSet {
+	return &orderedSet{index: make(map[string]int)}
+}
+
+func (s *orderedSet) len() int {
+	return len(s.index)
+}
+
+func (s *orderedSet) add(item string) {
+	if _, ok := s.index[item]; ok {
+		return
+	}
+	s.index[item] = len(s.items)
+	s.items = append(s.items, item)
+}
+
+func (s *orderedSet) remove(item string) {
+	i, ok := s.index[item]
+	if !ok {
+		return
+	}
+	delete(s.index, item)
+	s.items[i] = ""
+	s.holes++
+	if s.holes > len(s.index) {
+		s.compact()
+	}
+}
+
+func (s *orderedSet) compact() {
+	items := make([]string, 0, len(s.index))
+	for _, item := range s.items {
+		if item == "" {
+			continue
+		}
+		s.index[item] = len(items)
+		items = append(items, item)
+	}
+	s.items = items
+	s.holes = 0
+}
+
+func (s *orderedSet) page(offset, limit int) []string {
+	page := []string{}
+	if s.holes == 0 {
+		if offset >= len(s.items) {
+			return page
+		}
+		end := offset + limit
+		if end > len(s.items) {
+			end = len(s.items)
+		}
+		return append(page, s.items[offset:end]...)
+	}
+	for _, item := range s.items {
+		if len(page) == limit {
+			break
+		}
+		if item == "" {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		page = append(page, item)
+	}
+	return page
+}
+
+type MemoryAddrIndex struct {
+	lock  sync.RWMutex
+	utxos map[string]*orderedSet
+	txs   map[string]*orderedSet
+}
+
+func NewMemoryAddrIndex() *MemoryAddrIndex {
+	return &MemoryAddrIndex{
+		utxos: make(map[string]*orderedSet),
+		txs:   make(map[string]*orderedSet),
+	}
+}
+
+func (idx *MemoryAddrIndex) AddUTXO(address []byte, key string) error {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	addToSet(idx.utxos, address, key)
+	return nil
+}
+
+func (idx *MemoryAddrIndex) RemoveUTXO(address []byte, key string) error {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	removeFromSet(idx.utxos, address, key)
+	return nil
+}
+
+func (idx *MemoryAddrIndex) UTXOs(address []byte, offset, limit int) ([]string, int, error) {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+	keys, total := pageOfSet(idx.utxos, address, offset, limit)
+	return keys, total, nil
+}
+
+func (idx *MemoryAddrIndex) AddTx(address []byte, hash string) error {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	addToSet(idx.txs, address, hash)
+	return nil
+}
+
+func (idx *MemoryAddrIndex) RemoveTx(address []byte, hash string) error {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	removeFromSet(idx.txs, address, hash)
+	return nil
+}
+
+func (idx *MemoryAddrIndex) Txs(address []byte, offset, limit int) ([]string, int, error) {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+	hashes, total := pageOfSet(idx.txs, address, offset, limit)
+	return hashes, total, nil
+}
+
+func addToSet(sets map[string]*orderedSet, address []byte, item string) {
+	addr := hex.EncodeToString(address)
+	set, ok := sets[addr]
+	if !ok {
+		set = newOrderedSet()
+		sets[addr] = set
+	}
+	set.add(item)
+}
+
+func removeFromSet(sets map[string]*orderedSet, address []byte, item string) {
+	addr := hex.EncodeToString(address)
+	set, ok := sets[addr]
+	if !ok {
+		return
+	}
+	set.remove(item)
+	if set.len() == 0 {
+		delete(sets, addr)
+	}
+}
+
+func pageOfSet(sets map[string]*orderedSet, address []byte, offset, limit int) ([]string, int) {
+	set, ok := sets[hex.EncodeToString(address)]
+	if !ok {
+		return []string{}, 0
+	}
+	return set.page(offset, limit), set.len()
+}
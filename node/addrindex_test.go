@@ -0,0 +1,80 @@
+package node
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vazj/blocker/crypto"
+)
+
+func TestMemoryAddrIndexPaging(t *testing.T) {
+	var (
+		idx     = NewMemoryAddrIndex()
+		address = crypto.GeneratePrivateKey().Public().Address().Bytes()
+	)
+	for _, key := range []string{"a", "b", "c", "d", "b"} {
+		require.NoError(t, idx.AddUTXO(address, key))
+	}
+
+	keys, total, err := idx.UTXOs(address, 0, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 4, total)
+	assert.Equal(t, []string{"a", "b", "c"}, keys)
+
+	keys, _, err = idx.UTXOs(address, 3, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d"}, keys)
+
+	keys, _, err = idx.UTXOs(address, 10, 3)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	require.NoError(t, idx.RemoveUTXO(address, "b"))
+	keys, total, err = idx.UTXOs(address, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, []string{"a", "c", "d"}, keys)
+}
+
+func TestOrderedSetRemoveOldest(t *testing.T) {
+	s := newOrderedSet()
+	for i := 0; i < 10; i++ {
+		s.add(fmt.Sprint(i))
+	}
+	// spends remove the oldest items, the holes they leave are skipped
+	s.remove("0")
+	s.remove("1")
+	assert.Equal(t, 8, s.len())
+	assert.Equal(t, []string{"3", "4", "5"}, s.page(1, 3))
+
+	// holes never outnumber the items, they get compacted
+	for i := 2; i < 8; i++ {
+		s.remove(fmt.Sprint(i))
+		assert.LessOrEqual(t, len(s.items), 2*s.len())
+	}
+	assert.Equal(t, []string{"8", "9"}, s.page(0, 10))
+
+	// a removed item comes back last
+	s.add("0")
+	assert.Equal(t, []string{"8", "9", "0"}, s.page(0, 10))
+	s.remove("8")
+	assert.Equal(t, []string{"9", "0"}, s.page(0, 10))
+	assert.Empty(t, s.page(2, 10))
+}
+
+func TestMemoryAddrIndexUnknownAddress(t *testing.T) {
+	var (
+		idx     = NewMemoryAddrIndex()
+		address = crypto.GeneratePrivateKey().Public().Address().Bytes()
+	)
+	require.NoError(t, idx.AddTx(address, "tx"))
+	require.NoError(t, idx.RemoveTx(address, "tx"))
+	require.NoError(t, idx.RemoveTx(address, "tx"))
+
+	hashes, total, err := idx.Txs(address, 0, 10)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+	assert.Empty(t, hashes)
+}
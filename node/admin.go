@@ -0,0 +1,92 @@
+package node
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/proto"
+	"google.golang.org/grpc"
+)
+
+// AdminServer lets the operator of a node inspect and manage its peers. It
+// has no authentication and is meant to listen on a local address only.
+type AdminServer struct {
+	node *Node
+
+	proto.UnimplementedAdminServer
+}
+
+func NewAdminServer(n *Node) *AdminServer {
+	return &AdminServer{node: n}
+}
+
+func (s *AdminServer) ListPeers(ctx context.Context, _ *proto.Ack) (*proto.PeerInfoList, error) {
+	list := &proto.PeerInfoList{}
+	for _, p := range s.node.peers.List() {
+		list.Peers = append(list.Peers, &proto.PeerInfo{
+			PublicKey:  p.version.PublicKey,
+			ListenAddr: p.version.ListenAddr,
+			Outbound:   p.outbound,
+			Score:      int32(s.node.peers.Score(p.ID)),
+
+			ProtocolVersion: p.version.ProtocolVersion,
+			Services:        p.version.Services,
+		})
+	}
+	for id, until := range s.node.bans.List() {
+		pubKey, _ := hex.DecodeString(id)
+		list.Bans = append(list.Bans, &proto.BanInfo{
+			PublicKey: pubKey,
+			Until:     until.UnixNano(),
+		})
+	}
+	return list, nil
+}
+
+func (s *AdminServer) BanPeer(ctx context.Context, req *proto.BanRequest) (*proto.Ack, error) {
+	if len(req.PublicKey) != crypto.PubKeyLen {
+		return nil, fmt.Errorf("invalid public key length %d", len(req.PublicKey))
+	}
+	if req.Duration < 0 {
+		return nil, fmt.Errorf("invalid ban duration %d", req.Duration)
+	}
+	d := time.Duration(req.Duration)
+	if d == 0 {
+		d = defaultBanDuration
+	}
+	s.node.banPeer(req.PublicKey, d)
+	return &proto.Ack{}, nil
+}
+
+func (s *AdminServer) UnbanPeer(ctx context.Context, req *proto.BanRequest) (*proto.Ack, error) {
+	if len(req.PublicKey) != crypto.PubKeyLen {
+		return nil, fmt.Errorf("invalid public key length %d", len(req.PublicKey))
+	}
+	s.node.bans.Unban(req.PublicKey)
+	return &proto.Ack{}, nil
+}
+
+// serveAdmin serves the admin service on AdminAddr in the background.
+func (n *Node) serveAdmin() error {
+	grpcServer := grpc.NewServer()
+	proto.RegisterAdminServer(grpcServer, NewAdminServer(n))
+	if err := n.serve(grpcServer); err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", n.AdminAddr)
+	if err != nil {
+		return err
+	}
+	n.logger.Infow("admin server started...", "addr", n.AdminAddr)
+	n.spawn(func() {
+		if err := grpcServer.Serve(ln); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			n.logger.Errorw("admin server stopped", "err", err)
+		}
+	})
+	return nil
+}
@@ -2,9 +2,17 @@ package node
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
 
+	pb "github.com/golang/protobuf/proto"
 	"github.com/vazj/blocker/crypto"
 	"github.com/vazj/blocker/proto"
 	"github.com/vazj/blocker/types"
@@ -12,6 +20,32 @@ import (
 
 const godSeed = "f7b2e105abbf7b30cefc49019386f498ecc40e1db5472b7875fa223ead7c9389"
 
+const (
+	// blockVersion is the only header version this chain accepts.
+	blockVersion = 3
+	// medianTimeSpan is the number of previous headers used to compute
+	// the median time past a new block's timestamp must exceed.
+	medianTimeSpan = 11
+	// maxClockDrift is how far ahead of our local clock a block's
+	// timestamp is allowed to be.
+	maxClockDrift = 2 * time.Minute
+)
+
+var (
+	ErrInvalidBlockSignature = errors.New("block's signature is invalid")
+	ErrInvalidPrevHash       = errors.New("block's previous hash doesn't match the current block's hash")
+	ErrInvalidHeight         = errors.New("invalid block height")
+	ErrUnsupportedVersion    = errors.New("unsupported block version")
+	ErrTimestampTooOld       = errors.New("block timestamp is not after the median time past")
+	ErrTimestampTooNew       = errors.New("block timestamp is too far in the future")
+	ErrDisconnectGenesis     = errors.New("the genesis block can't be disconnected")
+	ErrDoubleSpend           = errors.New("output spent twice in the same block")
+	ErrInputNotOwned         = errors.New("input key doesn't own the output it spends")
+	ErrInvalidAmount         = errors.New("invalid output amount")
+	ErrOutputSpent           = errors.New("output already spent")
+	ErrInsufficientBalance   = errors.New("outputs exceed the inputs")
+)
+
 type HeaderList struct {
 	headers []*proto.Header
 }
@@ -33,6 +67,11 @@ func (hl *HeaderList) Get(index int) *proto.Header {
 	return hl.headers[index]
 }
 
+// RemoveLast drops the header at the top of the list.
+func (hl *HeaderList) RemoveLast() {
+	hl.headers = hl.headers[:hl.Len()-1]
+}
+
 func (hl *HeaderList) Len() int {
 	return len(hl.headers)
 }
@@ -42,38 +81,112 @@ func (hl *HeaderList) Height() int {
 	return hl.Len() - 1
 }
 
+// ValidateNext checks the consensus rules of a header that is meant to
+// extend the list.
+func (hl *HeaderList) ValidateNext(h *proto.Header) error {
+	if h.Version != blockVersion {
+		return fmt.Errorf("%w: got %d, want %d", ErrUnsupportedVersion, h.Version, blockVersion)
+	}
+
+	if int(h.Height) != hl.Height()+1 {
+		return fmt.Errorf("%w: got %d, want %d", ErrInvalidHeight, h.Height, hl.Height()+1)
+	}
+
+	// the timestamp has to move forward with respect to the median of the
+	// last blocks, which tolerates a few proposers with a skewed clock.
+	mtp := hl.MedianTimePast(medianTimeSpan)
+	if h.Timestamp <= mtp {
+		return fmt.Errorf("%w: got %d, median time past %d", ErrTimestampTooOld, h.Timestamp, mtp)
+	}
+
+	maxTimestamp := time.Now().Add(maxClockDrift).UnixNano()
+	if h.Timestamp > maxTimestamp {
+		return fmt.Errorf("%w: got %d, max allowed %d", ErrTimestampTooNew, h.Timestamp, maxTimestamp)
+	}
+
+	return nil
+}
+
+// MedianTimePast returns the median timestamp of the last n headers.
+func (hl *HeaderList) MedianTimePast(n int) int64 {
+	if n > hl.Len() {
+		n = hl.Len()
+	}
+	if n == 0 {
+		return 0
+	}
+	timestamps := make([]int64, 0, n)
+	for _, h := range hl.headers[hl.Len()-n:] {
+		timestamps = append(timestamps, h.Timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[n/2]
+}
+
+// utxoKey is the key of the output at index of the transaction with the
+// given hex encoded hash.
+func utxoKey(hash string, index int) string {
+	return fmt.Sprintf("%s_%d", hash, index)
+}
+
 type UTXO struct {
 	Hash     string
 	OutIndex int
 	Amount   int64
-	Spent    bool
+	// Address is the address the output pays to.
+	Address []byte
+	Spent   bool
 }
 
 type Chain struct {
+	// lock serializes the blocks being added with the reads of the tip.
+	lock       sync.RWMutex
+	params     ConsensusParams
 	txStore    TXStorer
 	utxStore   UTXOStorer
+	addrIndex  AddrIndexer
+	txIndex    TxIndexer
+	filters    FilterStorer
 	blockStore BlockStorer
 	headers    *HeaderList
 }
 
 func NewChain(blockStorer BlockStorer, txStore TXStorer) *Chain {
+	return NewChainWithParams(DefaultConsensusParams(), blockStorer, txStore)
+}
+
+func NewChainWithParams(params ConsensusParams, blockStorer BlockStorer, txStore TXStorer) *Chain {
+	return NewChainWithGenesis(createGenesisBlock(), params, blockStorer, txStore)
+}
+
+// NewChainWithGenesis creates a chain starting at the given genesis block,
+// which is trusted as is.
+func NewChainWithGenesis(genesis *proto.Block, params ConsensusParams, blockStorer BlockStorer, txStore TXStorer) *Chain {
 	chain := &Chain{
+		params:     params,
 		txStore:    txStore,
 		utxStore:   NewMemoryUTXOStore(), //TODO to pass as parameter
+		addrIndex:  NewMemoryAddrIndex(),
+		txIndex:    NewMemoryTxIndex(),
+		filters:    NewMemoryFilterStore(),
 		blockStore: blockStorer,
 		headers:    NewHeaderList(),
 	}
-	chain.addBlock(createGenesisBlock())
+	chain.addBlock(genesis)
 	return chain
 }
 
 // Height will always be at least 0 given the Genesis block
 func (c *Chain) Height() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 	return c.headers.Height()
 }
 
 func (c *Chain) AddBlock(b *proto.Block) error {
-	if err := c.ValidateBlock(b); err != nil {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.validateBlock(b); err != nil {
 		return err
 	}
 	return c.addBlock(b)
@@ -81,25 +194,39 @@ func (c *Chain) AddBlock(b *proto.Block) error {
 
 func (c *Chain) addBlock(b *proto.Block) error {
 	c.headers.Add(b.Header)
-	for _, tx := range b.Transactions {
-		fmt.Println("adding tx", hex.EncodeToString(types.HashTransaction(tx)))
+	blockHash := types.HashBlock(b)
+	for i, tx := range b.Transactions {
 		if err := c.txStore.Put(tx); err != nil {
 			return err
 		}
+		hash := hex.EncodeToString(types.HashTransaction(tx))
+		loc := &TxLocation{
+			BlockHash: blockHash,
+			Height:    int(b.Header.Height),
+			Index:     i,
+		}
+		if err := c.txIndex.Put(hash, loc); err != nil {
+			return err
+		}
+		touched := make([][]byte, 0, len(tx.Outputs)+len(tx.Inputs))
 		for it, output := range tx.Outputs {
-			hash := hex.EncodeToString(types.HashTransaction(tx))
 			utxo := &UTXO{
 				Hash:     hash,
 				OutIndex: it,
 				Amount:   output.Amount,
+				Address:  output.Address,
 				Spent:    false,
 			}
 			if err := c.utxStore.Put(utxo); err != nil {
 				return err
 			}
+			if err := c.addrIndex.AddUTXO(utxo.Address, utxoKey(hash, it)); err != nil {
+				return err
+			}
+			touched = append(touched, output.Address)
 		}
 		for _, input := range tx.Inputs {
-			key := fmt.Sprintf("%s_%d", hex.EncodeToString(input.PrevTxHash), input.PrevOutIndex)
+			key := utxoKey(hex.EncodeToString(input.PrevTxHash), int(input.PrevOutIndex))
 			utxo, err := c.utxStore.Get(key)
 			if err != nil {
 				return err
@@ -108,14 +235,189 @@ func (c *Chain) addBlock(b *proto.Block) error {
 			if err := c.utxStore.Put(utxo); err != nil {
 				return err
 			}
+			if err := c.addrIndex.RemoveUTXO(utxo.Address, key); err != nil {
+				return err
+			}
+			touched = append(touched, utxo.Address)
+		}
+		for _, address := range touched {
+			if err := c.addrIndex.AddTx(address, hash); err != nil {
+				return err
+			}
 		}
 	}
+	if err := c.addFilter(b, blockHash); err != nil {
+		return err
+	}
 	return c.blockStore.Put(b)
 }
 
+// addFilter stores the filter of b chained to the one of its parent.
+func (c *Chain) addFilter(b *proto.Block, blockHash []byte) error {
+	prevHeader := make([]byte, sha256.Size)
+	if b.Header.Height > 0 {
+		prev, err := c.filters.Get(hex.EncodeToString(b.Header.PrevHash))
+		if err != nil {
+			return err
+		}
+		prevHeader = prev.Header
+	}
+	filter := types.BuildBlockFilter(b).Bytes()
+	return c.filters.Put(hex.EncodeToString(blockHash), &BlockFilter{
+		Filter: filter,
+		Header: types.FilterHeader(filter, prevHeader),
+	})
+}
+
+// DisconnectTip removes the last block from the chain, reverting what its
+// transactions did to the UTXO set and the indexes, and returns it.
+func (c *Chain) DisconnectTip() (*proto.Block, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.headers.Height() == 0 {
+		return nil, ErrDisconnectGenesis
+	}
+	b, err := c.getBlockByHeight(c.headers.Height())
+	if err != nil {
+		return nil, err
+	}
+	for i := len(b.Transactions) - 1; i >= 0; i-- {
+		tx := b.Transactions[i]
+		hash := hex.EncodeToString(types.HashTransaction(tx))
+		touched := make([][]byte, 0, len(tx.Outputs)+len(tx.Inputs))
+		for _, input := range tx.Inputs {
+			key := utxoKey(hex.EncodeToString(input.PrevTxHash), int(input.PrevOutIndex))
+			utxo, err := c.utxStore.Get(key)
+			if err != nil {
+				return nil, err
+			}
+			utxo.Spent = false
+			if err := c.utxStore.Put(utxo); err != nil {
+				return nil, err
+			}
+			if err := c.addrIndex.AddUTXO(utxo.Address, key); err != nil {
+				return nil, err
+			}
+			touched = append(touched, utxo.Address)
+		}
+		for it, output := range tx.Outputs {
+			key := utxoKey(hash, it)
+			if err := c.utxStore.Delete(key); err != nil {
+				return nil, err
+			}
+			if err := c.addrIndex.RemoveUTXO(output.Address, key); err != nil {
+				return nil, err
+			}
+			touched = append(touched, output.Address)
+		}
+		for _, address := range touched {
+			if err := c.addrIndex.RemoveTx(address, hash); err != nil {
+				return nil, err
+			}
+		}
+		if err := c.txStore.Delete(hash); err != nil {
+			return nil, err
+		}
+		if err := c.txIndex.Delete(hash); err != nil {
+			return nil, err
+		}
+	}
+	blockHash := hex.EncodeToString(types.HashBlock(b))
+	if err := c.filters.Delete(blockHash); err != nil {
+		return nil, err
+	}
+	// a block left in the store would still be served and never be
+	// fetched again by a peer announcing it
+	if err := c.blockStore.Delete(blockHash); err != nil {
+		return nil, err
+	}
+	c.headers.RemoveLast()
+	return b, nil
+}
+
+// GetUTXOs returns up to limit unspent outputs paying to address, skipping
+// the first offset ones, and the total number of them.
+func (c *Chain) GetUTXOs(address []byte, offset, limit int) ([]*UTXO, int, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	keys, total, err := c.addrIndex.UTXOs(address, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	utxos := make([]*UTXO, 0, len(keys))
+	for _, key := range keys {
+		utxo, err := c.utxStore.Get(key)
+		if err != nil {
+			return nil, 0, err
+		}
+		// copied as the stored ones get spent under our feet
+		u := *utxo
+		utxos = append(utxos, &u)
+	}
+	return utxos, total, nil
+}
+
+// GetBalance returns the sum of the unspent outputs paying to address.
+func (c *Chain) GetBalance(address []byte) (int64, error) {
+	utxos, _, err := c.GetUTXOs(address, 0, math.MaxInt)
+	if err != nil {
+		return 0, err
+	}
+	balance := int64(0)
+	for _, utxo := range utxos {
+		balance += utxo.Amount
+	}
+	return balance, nil
+}
+
+// GetAddressTxs returns up to limit of the transactions touching address,
+// oldest first, skipping the first offset ones, and the total number of
+// them.
+func (c *Chain) GetAddressTxs(address []byte, offset, limit int) ([]*proto.Transaction, int, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	hashes, total, err := c.addrIndex.Txs(address, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	txs := make([]*proto.Transaction, 0, len(hashes))
+	for _, hash := range hashes {
+		tx, err := c.txStore.Get(hash)
+		if err != nil {
+			return nil, 0, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, total, nil
+}
+
+// Close flushes and closes the stores of the chain that support it.
+func (c *Chain) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var err error
+	for _, store := range []interface{}{c.blockStore, c.txStore, c.utxStore, c.addrIndex, c.txIndex, c.filters} {
+		if closer, ok := store.(io.Closer); ok {
+			if closeErr := closer.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return err
+}
+
 func (c *Chain) GetBlockByHeight(height int) (*proto.Block, error) {
-	if height > c.Height() {
-		return nil, fmt.Errorf("height[%d] is greater than the chain height[%d]", height, c.Height())
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.getBlockByHeight(height)
+}
+
+func (c *Chain) getBlockByHeight(height int) (*proto.Block, error) {
+	if height < 0 {
+		return nil, fmt.Errorf("invalid height[%d]", height)
+	}
+	if height > c.headers.Height() {
+		return nil, fmt.Errorf("height[%d] is greater than the chain height[%d]", height, c.headers.Height())
 	}
 	header := c.headers.Get(height)
 	hash := types.HashHeader(header)
@@ -127,85 +429,268 @@ func (c *Chain) GetBlockByHash(hash []byte) (*proto.Block, error) {
 	return c.blockStore.Get(hashHex)
 }
 
+// Tip returns the last block of the chain.
+func (c *Chain) Tip() (*proto.Block, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.getBlockByHeight(c.headers.Height())
+}
+
+// GetTransaction returns the confirmed transaction with the given hash.
+func (c *Chain) GetTransaction(hash []byte) (*proto.Transaction, error) {
+	return c.txStore.Get(hex.EncodeToString(hash))
+}
+
+// GetSignedHeaders returns up to limit headers, along with the signature of
+// their block, starting at height from.
+func (c *Chain) GetSignedHeaders(from, limit int) ([]*proto.SignedHeader, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if from < 0 {
+		return nil, fmt.Errorf("invalid height %d", from)
+	}
+	headers := make([]*proto.SignedHeader, 0)
+	for height := from; height <= c.headers.Height() && len(headers) < limit; height++ {
+		b, err := c.getBlockByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, &proto.SignedHeader{
+			Header:    b.Header,
+			PublicKey: b.PublicKey,
+			Signature: b.Signature,
+		})
+	}
+	return headers, nil
+}
+
+// GetBlockFilters returns up to limit block filters starting at height
+// from.
+func (c *Chain) GetBlockFilters(from, limit int) ([]*proto.BlockFilter, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if from < 0 {
+		return nil, fmt.Errorf("invalid height %d", from)
+	}
+	filters := make([]*proto.BlockFilter, 0)
+	for height := from; height <= c.headers.Height() && len(filters) < limit; height++ {
+		hash := types.HashHeader(c.headers.Get(height))
+		f, err := c.filters.Get(hex.EncodeToString(hash))
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, &proto.BlockFilter{
+			BlockHash: hash,
+			Height:    int32(height),
+			Filter:    f.Filter,
+		})
+	}
+	return filters, nil
+}
+
+// GetFilterHeaders returns up to limit filter headers starting at height
+// from, and the filter header they are chained to.
+func (c *Chain) GetFilterHeaders(from, limit int) ([][]byte, []byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if from < 0 {
+		return nil, nil, fmt.Errorf("invalid height %d", from)
+	}
+	prevHeader := make([]byte, sha256.Size)
+	if from > 0 && from <= c.headers.Height() {
+		prev, err := c.filters.Get(hex.EncodeToString(types.HashHeader(c.headers.Get(from - 1))))
+		if err != nil {
+			return nil, nil, err
+		}
+		prevHeader = prev.Header
+	}
+	headers := make([][]byte, 0)
+	for height := from; height <= c.headers.Height() && len(headers) < limit; height++ {
+		f, err := c.filters.Get(hex.EncodeToString(types.HashHeader(c.headers.Get(height))))
+		if err != nil {
+			return nil, nil, err
+		}
+		headers = append(headers, f.Header)
+	}
+	return headers, prevHeader, nil
+}
+
+// GetTransactionInfo returns the transaction with the given hash along with
+// where it is in the chain, how deep it is buried and the proof that its
+// block includes it.
+func (c *Chain) GetTransactionInfo(hash []byte) (*proto.TransactionInfo, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	key := hex.EncodeToString(hash)
+	tx, err := c.txStore.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := c.txIndex.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	block, err := c.blockStore.Get(hex.EncodeToString(loc.BlockHash))
+	if err != nil {
+		return nil, err
+	}
+	proof, err := types.NewMerkleProof(block, loc.Index)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.TransactionInfo{
+		Transaction:   tx,
+		BlockHash:     loc.BlockHash,
+		Height:        int32(loc.Height),
+		Index:         uint32(loc.Index),
+		Confirmations: int32(c.headers.Height() - loc.Height + 1),
+		Proof:         proof,
+	}, nil
+}
+
 func (c *Chain) ValidateBlock(b *proto.Block) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.validateBlock(b)
+}
+
+func (c *Chain) validateBlock(b *proto.Block) error {
+	// validate the size limits before doing any expensive work
+	if err := c.validateLimits(b); err != nil {
+		return err
+	}
+
 	// validate the signature of the block
 	if !types.VerifyBlock(b) {
-		return fmt.Errorf("block's signature is invalid")
+		return ErrInvalidBlockSignature
 	}
 
 	// validate if the prev hash of the block is the actual hash of the previous block
-	currentBlock, err := c.GetBlockByHeight(c.Height())
+	currentBlock, err := c.getBlockByHeight(c.headers.Height())
 	if err != nil {
 		return err
 	}
 	hash := types.HashBlock(currentBlock)
 	if !bytes.Equal(b.Header.PrevHash, hash) {
-		return fmt.Errorf("block's previous hash doesn't match the current block's hash")
+		return ErrInvalidPrevHash
 	}
 
-	// validate the transactions
+	if err := c.validateHeader(b.Header); err != nil {
+		return err
+	}
+
+	// validate the transactions, none of them spending an output another
+	// one of the block already spends
+	spent := make(map[string]bool)
 	for _, tx := range b.Transactions {
-		if err := c.ValidateTransaction(tx); err != nil {
+		if err := c.validateTransaction(tx, spent); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func (c *Chain) validateLimits(b *proto.Block) error {
+	if len(b.Transactions) > c.params.MaxBlockTxs {
+		return fmt.Errorf("%w: got %d, max %d", ErrTooManyTxs, len(b.Transactions), c.params.MaxBlockTxs)
+	}
+	if size := pb.Size(b); size > c.params.MaxBlockBytes {
+		return fmt.Errorf("%w: got %d bytes, max %d", ErrBlockTooLarge, size, c.params.MaxBlockBytes)
+	}
+	for _, tx := range b.Transactions {
+		if size := pb.Size(tx); size > c.params.MaxTxBytes {
+			return fmt.Errorf("%w: got %d bytes, max %d", ErrTxTooLarge, size, c.params.MaxTxBytes)
+		}
+	}
+	return nil
+}
+
+// ValidateHeader checks the consensus rules of a header that is meant to
+// extend the current tip of the chain.
+func (c *Chain) ValidateHeader(h *proto.Header) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.validateHeader(h)
+}
+
+func (c *Chain) validateHeader(h *proto.Header) error {
+	return c.headers.ValidateNext(h)
+}
+
 func (c *Chain) ValidateTransaction(tx *proto.Transaction) error {
+	return c.ValidateBlockTransaction(tx, make(map[string]bool))
+}
+
+// ValidateBlockTransaction validates tx as the next transaction of a block
+// whose previous transactions spend the outputs in spent, by key. The
+// outputs tx spends are added to spent when it is valid.
+func (c *Chain) ValidateBlockTransaction(tx *proto.Transaction, spent map[string]bool) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.validateTransaction(tx, spent)
+}
+
+func (c *Chain) validateTransaction(tx *proto.Transaction, spent map[string]bool) error {
 	// validate the signature of the transaction
 	if !types.VerifyTransaction(tx) {
-		return fmt.Errorf("transaction's signature is invalid")
+		return ErrInvalidTxSignature
 	}
-	// check if all inputs are unspent
+	// check if all inputs are unspent, both in the chain and in the block
 	nInputs := len(tx.Inputs)
 	sumInputs := int64(0)
+	keys := make(map[string]bool, nInputs)
 	for i := 0; i < nInputs; i++ {
 		prevHash := hex.EncodeToString(tx.Inputs[i].PrevTxHash)
-		key := fmt.Sprintf("%s_%d", prevHash, i)
+		key := utxoKey(prevHash, int(tx.Inputs[i].PrevOutIndex))
+		if spent[key] || keys[key] {
+			return fmt.Errorf("%w: input at index %d spends %s", ErrDoubleSpend, i, key)
+		}
+		keys[key] = true
 		utxo, err := c.utxStore.Get(key)
 		if err != nil {
 			return err
 		}
-		sumInputs += utxo.Amount
 		if utxo.Spent {
-			return fmt.Errorf("input at index %d of this transaction %s already spent", i, prevHash)
+			return fmt.Errorf("%w: input at index %d spends %s", ErrOutputSpent, i, key)
+		}
+		address := crypto.PublicKeyFromBytes(tx.Inputs[i].PublicKey).Address().Bytes()
+		if !bytes.Equal(address, utxo.Address) {
+			return fmt.Errorf("%w: input at index %d spends %s", ErrInputNotOwned, i, key)
 		}
+		if utxo.Amount > math.MaxInt64-sumInputs {
+			return fmt.Errorf("%w: inputs overflow", ErrInvalidAmount)
+		}
+		sumInputs += utxo.Amount
 	}
 
 	// check if the sum of the inputs is greater than the sum of the outputs
 	sumOutputs := int64(0)
-	for _, output := range tx.Outputs {
+	for i, output := range tx.Outputs {
+		if output.Amount < 0 {
+			return fmt.Errorf("%w: output at index %d has a negative amount %d", ErrInvalidAmount, i, output.Amount)
+		}
+		if output.Amount > math.MaxInt64-sumOutputs {
+			return fmt.Errorf("%w: outputs overflow", ErrInvalidAmount)
+		}
 		sumOutputs += output.Amount
 	}
 
 	if sumInputs < sumOutputs {
-		return fmt.Errorf("insufficient balance got %d, spending %d", sumInputs, sumOutputs)
+		return fmt.Errorf("%w: got %d, spending %d", ErrInsufficientBalance, sumInputs, sumOutputs)
 	}
 
+	for key := range keys {
+		spent[key] = true
+	}
 	return nil
 }
 
 func createGenesisBlock() *proto.Block {
 	privKey := crypto.NewPrivateKeyFromSeedStr(godSeed)
-	block := &proto.Block{
-		Header: &proto.Header{
-			Version: 1,
+	return NewGenesisBlock(privKey, 0, []GenesisAlloc{
+		{
+			Address: privKey.PublicKey().Address().Bytes(),
+			Amount:  1000,
 		},
-	}
-	tx := &proto.Transaction{
-		Version: 1,
-		Inputs:  []*proto.TxInput{},
-		Outputs: []*proto.TxOutput{
-			{
-				Amount:  1000,
-				Address: privKey.PublicKey().Address().Bytes(),
-			},
-		},
-	}
-
-	block.Transactions = append(block.Transactions, tx)
-
-	types.SignBlock(privKey, block)
-	return block
+	})
 }
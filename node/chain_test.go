@@ -1,11 +1,15 @@
 package node
 
 import (
+	"encoding/hex"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/gcs"
 	"github.com/vazj/blocker/proto"
 	"github.com/vazj/blocker/types"
 	"github.com/vazj/blocker/util"
@@ -13,10 +17,9 @@ import (
 
 func randomBlock(t *testing.T, chain *Chain) *proto.Block {
 	privKey := crypto.GeneratePrivateKey()
-	block := util.RandomBlock()
 	prevBlock, err := chain.GetBlockByHeight(chain.Height())
 	require.NoError(t, err)
-	block.Header.PrevHash = types.HashBlock(prevBlock)
+	block := util.RandomBlockAfter(prevBlock.Header, types.HashBlock(prevBlock))
 	types.SignBlock(privKey, block)
 	return block
 }
@@ -65,6 +68,100 @@ func TestAddBlock(t *testing.T) {
 	}
 }
 
+func TestAddBlockInvalidHeight(t *testing.T) {
+	chain := NewChain(NewMemoryBlockStore(), NewMemoryTXStore())
+	for _, height := range []int32{0, 2, 1000} {
+		block := randomBlock(t, chain)
+		block.Header.Height = height
+		types.SignBlock(crypto.GeneratePrivateKey(), block)
+		assert.ErrorIs(t, chain.AddBlock(block), ErrInvalidHeight)
+	}
+	assert.Equal(t, 0, chain.Height())
+}
+
+func TestAddBlockUnsupportedVersion(t *testing.T) {
+	chain := NewChain(NewMemoryBlockStore(), NewMemoryTXStore())
+	block := randomBlock(t, chain)
+	block.Header.Version = blockVersion + 1
+	types.SignBlock(crypto.GeneratePrivateKey(), block)
+	assert.ErrorIs(t, chain.AddBlock(block), ErrUnsupportedVersion)
+}
+
+func TestAddBlockTimestamp(t *testing.T) {
+	chain := NewChain(NewMemoryBlockStore(), NewMemoryTXStore())
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < medianTimeSpan; i++ {
+		block := randomBlock(t, chain)
+		block.Header.Timestamp = start.Add(time.Duration(i) * time.Minute).UnixNano()
+		types.SignBlock(crypto.GeneratePrivateKey(), block)
+		require.NoError(t, chain.AddBlock(block))
+	}
+
+	// the median of the last 11 blocks is the 6th of the ones above.
+	mtp := start.Add(5 * time.Minute).UnixNano()
+	assert.Equal(t, mtp, chain.headers.MedianTimePast(medianTimeSpan))
+
+	block := randomBlock(t, chain)
+	block.Header.Timestamp = mtp
+	types.SignBlock(crypto.GeneratePrivateKey(), block)
+	assert.ErrorIs(t, chain.AddBlock(block), ErrTimestampTooOld)
+
+	block.Header.Timestamp = time.Now().Add(maxClockDrift + time.Minute).UnixNano()
+	types.SignBlock(crypto.GeneratePrivateKey(), block)
+	assert.ErrorIs(t, chain.AddBlock(block), ErrTimestampTooNew)
+
+	// older than the parent but after the median time past is accepted
+	block.Header.Timestamp = mtp + 1
+	types.SignBlock(crypto.GeneratePrivateKey(), block)
+	assert.NoError(t, chain.AddBlock(block))
+}
+
+func TestMedianTimePast(t *testing.T) {
+	hl := NewHeaderList()
+	assert.Equal(t, int64(0), hl.MedianTimePast(medianTimeSpan))
+	for _, ts := range []int64{5, 1, 4, 2, 3} {
+		hl.Add(&proto.Header{Timestamp: ts})
+	}
+	assert.Equal(t, int64(3), hl.MedianTimePast(medianTimeSpan))
+	assert.Equal(t, int64(3), hl.MedianTimePast(2))
+	assert.Equal(t, int64(3), hl.MedianTimePast(1))
+}
+
+func TestAddBlockLimits(t *testing.T) {
+	params := ConsensusParams{
+		MaxBlockBytes: 1024,
+		MaxBlockTxs:   2,
+		MaxTxBytes:    256,
+	}
+	chain := NewChainWithParams(params, NewMemoryBlockStore(), NewMemoryTXStore())
+
+	block := randomBlock(t, chain)
+	for i := 0; i < 3; i++ {
+		block.Transactions = append(block.Transactions, &proto.Transaction{Version: 1})
+	}
+	types.SignBlock(crypto.GeneratePrivateKey(), block)
+	assert.ErrorIs(t, chain.AddBlock(block), ErrTooManyTxs)
+
+	block = randomBlock(t, chain)
+	block.Transactions = append(block.Transactions, &proto.Transaction{
+		Version: 1,
+		Outputs: []*proto.TxOutput{{Amount: 1, Address: make([]byte, 512)}},
+	})
+	types.SignBlock(crypto.GeneratePrivateKey(), block)
+	assert.ErrorIs(t, chain.AddBlock(block), ErrTxTooLarge)
+
+	block = randomBlock(t, chain)
+	for i := 0; i < 2; i++ {
+		block.Transactions = append(block.Transactions, &proto.Transaction{
+			Version: 1,
+			Outputs: []*proto.TxOutput{{Amount: 1, Address: make([]byte, 200)}},
+		})
+	}
+	block.Header.PrevHash = make([]byte, 700)
+	types.SignBlock(crypto.GeneratePrivateKey(), block)
+	assert.ErrorIs(t, chain.AddBlock(block), ErrBlockTooLarge)
+}
+
 func TestAddBlockWithTxInsufficientFunds(t *testing.T) {
 	var (
 		chain     = NewChain(NewMemoryBlockStore(), NewMemoryTXStore())
@@ -74,7 +171,7 @@ func TestAddBlockWithTxInsufficientFunds(t *testing.T) {
 		recipient = crypto.GeneratePrivateKey().Public().Address().Bytes()
 	)
 
-	prevTx, err := chain.txStore.Get("efb7e770f59b223434e32e41c2ed21c56ab6081fef99d7a16c9b1aac278c4fb5")
+	prevTx, err := chain.txStore.Get("b645bb9ed5f3035c9c93cb26ee5f9e2eaa4830ccc6e2cde17e53c3e52cf7b0e9")
 	require.NoError(t, err)
 
 	inputs := []*proto.TxInput{
@@ -111,7 +208,7 @@ func TestAddBlockWithTx(t *testing.T) {
 		recipient = crypto.GeneratePrivateKey().Public().Address().Bytes()
 	)
 
-	prevTx, err := chain.txStore.Get("efb7e770f59b223434e32e41c2ed21c56ab6081fef99d7a16c9b1aac278c4fb5")
+	prevTx, err := chain.txStore.Get("b645bb9ed5f3035c9c93cb26ee5f9e2eaa4830ccc6e2cde17e53c3e52cf7b0e9")
 	require.NoError(t, err)
 
 	inputs := []*proto.TxInput{
@@ -143,3 +240,268 @@ func TestAddBlockWithTx(t *testing.T) {
 	require.NoError(t, chain.AddBlock(block))
 
 }
+
+// spendGenesis returns a transaction spending the genesis output of chain
+// to outputs, signed by privKey.
+func spendGenesis(t *testing.T, chain *Chain, privKey *crypto.PrivateKey, outputs ...*proto.TxOutput) *proto.Transaction {
+	genesis, err := chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash:   types.HashTransaction(genesis.Transactions[0]),
+			PrevOutIndex: 0,
+			PublicKey:    privKey.Public().Bytes(),
+		}},
+		Outputs: outputs,
+	}
+	tx.Inputs[0].Signature = types.SignTransaction(privKey, tx).Bytes()
+	return tx
+}
+
+func TestAddBlockDoubleSpend(t *testing.T) {
+	var (
+		chain     = NewChain(NewMemoryBlockStore(), NewMemoryTXStore())
+		privKey   = crypto.NewPrivateKeyFromSeedStr(godSeed)
+		recipient = crypto.GeneratePrivateKey().Public().Address().Bytes()
+		a         = spendGenesis(t, chain, privKey, &proto.TxOutput{Amount: 1000, Address: recipient})
+		b         = spendGenesis(t, chain, privKey, &proto.TxOutput{Amount: 999, Address: recipient})
+	)
+	// each is valid on its own, not both in the same block
+	require.NoError(t, chain.ValidateTransaction(a))
+	require.NoError(t, chain.ValidateTransaction(b))
+	block := randomBlock(t, chain)
+	block.Transactions = []*proto.Transaction{a, b}
+	types.SignBlock(privKey, block)
+	assert.ErrorIs(t, chain.AddBlock(block), ErrDoubleSpend)
+
+	// nor twice in the same transaction
+	twice := spendGenesis(t, chain, privKey, &proto.TxOutput{Amount: 2000, Address: recipient})
+	twice.Inputs = append(twice.Inputs, &proto.TxInput{
+		PrevTxHash:   twice.Inputs[0].PrevTxHash,
+		PrevOutIndex: 0,
+		PublicKey:    privKey.Public().Bytes(),
+	})
+	for _, in := range twice.Inputs {
+		in.Signature = types.SignTransaction(privKey, twice).Bytes()
+	}
+	assert.ErrorIs(t, chain.ValidateTransaction(twice), ErrDoubleSpend)
+
+	block.Transactions = []*proto.Transaction{a}
+	types.SignBlock(privKey, block)
+	require.NoError(t, chain.AddBlock(block))
+	assert.Equal(t, 1, chain.Height())
+}
+
+func TestValidateTransactionAmountsAndOwner(t *testing.T) {
+	var (
+		chain     = NewChain(NewMemoryBlockStore(), NewMemoryTXStore())
+		privKey   = crypto.NewPrivateKeyFromSeedStr(godSeed)
+		recipient = crypto.GeneratePrivateKey().Public().Address().Bytes()
+	)
+	// a valid signature by another key doesn't spend the genesis output
+	thief := spendGenesis(t, chain, crypto.GeneratePrivateKey(), &proto.TxOutput{Amount: 1000, Address: recipient})
+	assert.ErrorIs(t, chain.ValidateTransaction(thief), ErrInputNotOwned)
+
+	// a negative output can't make up for a larger one
+	negative := spendGenesis(t, chain, privKey,
+		&proto.TxOutput{Amount: 1000000, Address: recipient},
+		&proto.TxOutput{Amount: -999000, Address: recipient},
+	)
+	assert.ErrorIs(t, chain.ValidateTransaction(negative), ErrInvalidAmount)
+
+	overflow := spendGenesis(t, chain, privKey,
+		&proto.TxOutput{Amount: math.MaxInt64, Address: recipient},
+		&proto.TxOutput{Amount: 2, Address: recipient},
+	)
+	assert.ErrorIs(t, chain.ValidateTransaction(overflow), ErrInvalidAmount)
+
+	valid := spendGenesis(t, chain, privKey, &proto.TxOutput{Amount: 1000, Address: recipient})
+	assert.NoError(t, chain.ValidateTransaction(valid))
+}
+
+func TestGetUTXOs(t *testing.T) {
+	var (
+		chain     = NewChain(NewMemoryBlockStore(), NewMemoryTXStore())
+		privKey   = crypto.NewPrivateKeyFromSeedStr(godSeed)
+		address   = privKey.Public().Address().Bytes()
+		recipient = crypto.GeneratePrivateKey().Public().Address().Bytes()
+	)
+
+	utxos, _, err := chain.GetUTXOs(address, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, utxos, 1)
+	assert.Equal(t, int64(1000), utxos[0].Amount)
+
+	// spend the genesis output, then the change at index 1 of that tx
+	spend := func(utxo *UTXO, amount int64) *proto.Transaction {
+		prevHash, err := hex.DecodeString(utxo.Hash)
+		require.NoError(t, err)
+		tx := &proto.Transaction{
+			Version: 1,
+			Inputs: []*proto.TxInput{{
+				PrevTxHash:   prevHash,
+				PrevOutIndex: uint32(utxo.OutIndex),
+				PublicKey:    privKey.Public().Bytes(),
+			}},
+			Outputs: []*proto.TxOutput{
+				{Amount: amount, Address: recipient},
+				{Amount: utxo.Amount - amount, Address: address},
+			},
+		}
+		tx.Inputs[0].Signature = types.SignTransaction(privKey, tx).Bytes()
+		block := randomBlock(t, chain)
+		block.Transactions = append(block.Transactions, tx)
+		types.SignBlock(privKey, block)
+		require.NoError(t, chain.AddBlock(block))
+		return tx
+	}
+	spend(utxos[0], 100)
+	utxos, _, err = chain.GetUTXOs(address, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, utxos, 1)
+	assert.Equal(t, 1, utxos[0].OutIndex)
+	assert.Equal(t, int64(900), utxos[0].Amount)
+
+	spend(utxos[0], 200)
+	utxos, _, err = chain.GetUTXOs(address, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, utxos, 1)
+	assert.Equal(t, int64(700), utxos[0].Amount)
+
+	utxos, total, err := chain.GetUTXOs(recipient, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	require.Len(t, utxos, 1)
+	assert.Equal(t, int64(200), utxos[0].Amount)
+
+	balance, err := chain.GetBalance(recipient)
+	require.NoError(t, err)
+	assert.Equal(t, int64(300), balance)
+
+	txs, total, err := chain.GetAddressTxs(address, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Len(t, txs, 3)
+}
+
+func TestDisconnectTip(t *testing.T) {
+	var (
+		chain     = NewChain(NewMemoryBlockStore(), NewMemoryTXStore())
+		privKey   = crypto.NewPrivateKeyFromSeedStr(godSeed)
+		address   = privKey.Public().Address().Bytes()
+		recipient = crypto.GeneratePrivateKey().Public().Address().Bytes()
+	)
+
+	_, err := chain.DisconnectTip()
+	assert.ErrorIs(t, err, ErrDisconnectGenesis)
+
+	before, _, err := chain.GetUTXOs(address, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, before, 1)
+	prevHash, err := hex.DecodeString(before[0].Hash)
+	require.NoError(t, err)
+
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash: prevHash,
+			PublicKey:  privKey.Public().Bytes(),
+		}},
+		Outputs: []*proto.TxOutput{
+			{Amount: 100, Address: recipient},
+			{Amount: 900, Address: address},
+		},
+	}
+	tx.Inputs[0].Signature = types.SignTransaction(privKey, tx).Bytes()
+	block := randomBlock(t, chain)
+	block.Transactions = append(block.Transactions, tx)
+	types.SignBlock(privKey, block)
+	require.NoError(t, chain.AddBlock(block))
+
+	disconnected, err := chain.DisconnectTip()
+	require.NoError(t, err)
+	assert.Equal(t, types.HashBlock(block), types.HashBlock(disconnected))
+	assert.Equal(t, 0, chain.Height())
+	_, err = chain.GetBlockByHash(types.HashBlock(block))
+	assert.Error(t, err)
+
+	after, _, err := chain.GetUTXOs(address, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+	_, total, err := chain.GetUTXOs(recipient, 0, 10)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+	_, total, err = chain.GetAddressTxs(address, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	_, err = chain.GetTransaction(types.HashTransaction(tx))
+	assert.Error(t, err)
+
+	// the restored output can be spent again
+	block = randomBlock(t, chain)
+	block.Transactions = append(block.Transactions, tx)
+	types.SignBlock(privKey, block)
+	require.NoError(t, chain.AddBlock(block))
+}
+
+func TestGetTransactionInfo(t *testing.T) {
+	chain := NewChain(NewMemoryBlockStore(), NewMemoryTXStore())
+	genesis, err := chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+	hash := types.HashTransaction(genesis.Transactions[0])
+
+	info, err := chain.GetTransactionInfo(hash)
+	require.NoError(t, err)
+	assert.Equal(t, types.HashBlock(genesis), info.BlockHash)
+	assert.Equal(t, int32(0), info.Height)
+	assert.Equal(t, uint32(0), info.Index)
+	assert.Equal(t, int32(1), info.Confirmations)
+	assert.Equal(t, hash, info.Proof.TxHash)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, chain.AddBlock(randomBlock(t, chain)))
+	}
+	info, err = chain.GetTransactionInfo(hash)
+	require.NoError(t, err)
+	assert.Equal(t, int32(4), info.Confirmations)
+
+	_, err = chain.GetTransactionInfo(util.RandomHash())
+	assert.Error(t, err)
+}
+
+func TestBlockFilters(t *testing.T) {
+	var (
+		chain   = NewChain(NewMemoryBlockStore(), NewMemoryTXStore())
+		address = crypto.NewPrivateKeyFromSeedStr(godSeed).Public().Address().Bytes()
+	)
+	require.NoError(t, chain.AddBlock(randomBlock(t, chain)))
+
+	filters, err := chain.GetBlockFilters(0, 10)
+	require.NoError(t, err)
+	require.Len(t, filters, 2)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+	genesisFilter, err := gcs.FromBytes(filters[0].Filter)
+	require.NoError(t, err)
+	assert.True(t, genesisFilter.Match(types.FilterKey(genesis.Header.PrevHash), address))
+	assert.Equal(t, genesis.Header.FilterHash, types.HashFilter(filters[0].Filter))
+
+	headers, prevHeader, err := chain.GetFilterHeaders(0, 10)
+	require.NoError(t, err)
+	require.Len(t, headers, 2)
+	assert.Equal(t, make([]byte, 32), prevHeader)
+	assert.Equal(t, types.FilterHeader(filters[0].Filter, prevHeader), headers[0])
+	assert.Equal(t, types.FilterHeader(filters[1].Filter, headers[0]), headers[1])
+
+	tail, prevHeader, err := chain.GetFilterHeaders(1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, headers[0], prevHeader)
+	assert.Equal(t, headers[1:], tail)
+
+	_, err = chain.DisconnectTip()
+	require.NoError(t, err)
+	filters, err = chain.GetBlockFilters(0, 10)
+	require.NoError(t, err)
+	assert.Len(t, filters, 1)
+}
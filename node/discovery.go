@@ -0,0 +1,115 @@
+package node
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/vazj/blocker/proto"
+)
+
+const (
+	// discoveryInterval is how often we exchange addresses with our peers
+	// and top up our outbound connections.
+	discoveryInterval = 30 * time.Second
+	// fastDiscoveryInterval is used instead while we have fewer than
+	// MinOutboundPeers outbound peers.
+	fastDiscoveryInterval = 2 * time.Second
+	// maxGetPeersAddrs caps the number of addresses exchanged at once.
+	maxGetPeersAddrs = 100
+	getPeersTimeout  = 5 * time.Second
+)
+
+// GetPeers returns a sample of the addresses in our address book.
+func (n *Node) GetPeers(ctx context.Context, _ *proto.Ack) (*proto.PeerList, error) {
+	return &proto.PeerList{Addrs: n.addrBook.Sample(maxGetPeersAddrs)}, nil
+}
+
+func (n *Node) discoveryLoop() {
+	for {
+		n.discover()
+		interval := discoveryInterval
+		if n.peers.Outbound() < n.MinOutboundPeers {
+			interval = fastDiscoveryInterval
+		}
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// discover asks a random peer for the addresses it knows about and dials
+// new peers from the address book until we have MaxOutboundPeers of them.
+func (n *Node) discover() {
+	n.exchangeAddrs()
+
+	missing := n.MaxOutboundPeers - n.peers.Outbound()
+	if missing > 0 {
+		var (
+			wg    sync.WaitGroup
+			addrs = n.addrBook.Select(missing, n.peers.OutboundAddrs(), func(addr string) bool {
+				return !n.canConnectWith(addr)
+			})
+		)
+		for _, addr := range addrs {
+			wg.Add(1)
+			go func(addr string) {
+				defer wg.Done()
+				if err := n.connect(addr); err != nil {
+					n.logger.Debugw("failed to dial remote node", "addr", addr, "err", err)
+				}
+			}(addr)
+		}
+		wg.Wait()
+	}
+
+	if err := n.addrBook.Save(); err != nil {
+		n.logger.Errorw("error saving address book", "err", err)
+	}
+}
+
+// exchangeAddrs fills the address book with the addresses known by a
+// random peer.
+func (n *Node) exchangeAddrs() {
+	peers := make([]*Peer, 0)
+	for _, p := range n.peers.List() {
+		if p.Supports(protocolPeerExchange) {
+			peers = append(peers, p)
+		}
+	}
+	if len(peers) == 0 {
+		return
+	}
+	p := peers[rand.Intn(len(peers))]
+	ctx, cancel := context.WithTimeout(n.ctx, getPeersTimeout)
+	defer cancel()
+	list, err := p.client.GetPeers(ctx, &proto.Ack{})
+	if err != nil {
+		n.peerFailed(p, err)
+		return
+	}
+	n.addAddrs(hostOf(p.version.ListenAddr), list.Addrs)
+}
+
+// addAddrs adds the addresses a peer reachable on host told us about to the
+// address book, up to maxGetPeersAddrs of them. Addresses without a host
+// are the ones of nodes listening on all the interfaces of the peer's
+// machine and get its host, other addresses have to be IP literals.
+func (n *Node) addAddrs(host string, addrs []string) {
+	if len(addrs) > maxGetPeersAddrs {
+		addrs = addrs[:maxGetPeersAddrs]
+	}
+	for _, addr := range addrs {
+		addr = resolveAddr(addr, host)
+		if !isIPAddr(addr) {
+			n.logger.Debugw("ignoring peer address", "addr", addr, "from", host)
+			continue
+		}
+		if addr != n.ListenAddr {
+			n.addrBook.Add(addr)
+		}
+	}
+}
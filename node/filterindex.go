@@ -0,0 +1,55 @@
+package node
+
+import (
+	"fmt"
+	"sync"
+)
+
+// BlockFilter is the compact filter of a block along with its filter
+// header.
+type BlockFilter struct {
+	Filter []byte
+	Header []byte
+}
+
+// FilterStorer stores the filters of the blocks by hex encoded block hash.
+type FilterStorer interface {
+	Put(hash string, f *BlockFilter) error
+	Get(hash string) (*BlockFilter, error)
+	Delete(hash string) error
+}
+
+type MemoryFilterStore struct {
+	lock    sync.RWMutex
+	filters map[string]*BlockFilter
+}
+
+func NewMemoryFilterStore() *MemoryFilterStore {
+	return &MemoryFilterStore{
+		filters: make(map[string]*BlockFilter),
+	}
+}
+
+func (s *MemoryFilterStore) Put(hash string, f *BlockFilter) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.filters[hash] = f
+	return nil
+}
+
+func (s *MemoryFilterStore) Get(hash string) (*BlockFilter, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	f, ok := s.filters[hash]
+	if !ok {
+		return nil, fmt.Errorf("could not find filter of block with hash %s", hash)
+	}
+	return f, nil
+}
+
+func (s *MemoryFilterStore) Delete(hash string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.filters, hash)
+	return nil
+}
@@ -0,0 +1,73 @@
+package node
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/types"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var ErrInvalidGenesis = errors.New("invalid genesis block")
+
+// GenesisAlloc credits Amount coins to Address in the genesis block.
+type GenesisAlloc struct {
+	Address []byte
+	Amount  int64
+}
+
+// NewGenesisBlock creates the first block of a chain, signed by privKey and
+// holding a single transaction that mints the allocations.
+func NewGenesisBlock(privKey *crypto.PrivateKey, timestamp int64, allocs []GenesisAlloc) *proto.Block {
+	block := &proto.Block{
+		Header: &proto.Header{
+			Version:   blockVersion,
+			Timestamp: timestamp,
+		},
+	}
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{},
+	}
+	for _, alloc := range allocs {
+		tx.Outputs = append(tx.Outputs, &proto.TxOutput{
+			Amount:  alloc.Amount,
+			Address: alloc.Address,
+		})
+	}
+	block.Transactions = append(block.Transactions, tx)
+
+	types.SignBlock(privKey, block)
+	return block
+}
+
+// LoadGenesis reads a JSON encoded genesis block and checks its signature.
+func LoadGenesis(path string) (*proto.Block, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block := &proto.Block{}
+	if err := protojson.Unmarshal(b, block); err != nil {
+		return nil, err
+	}
+	if block.Header == nil || block.Header.Height != 0 || !types.VerifyBlock(block) {
+		return nil, ErrInvalidGenesis
+	}
+	return block, nil
+}
+
+// SaveGenesis stores block JSON encoded at path.
+func SaveGenesis(path string, block *proto.Block) error {
+	b, err := protojson.MarshalOptions{Multiline: true}.Marshal(block)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
@@ -0,0 +1,319 @@
+package node
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/types"
+)
+
+const (
+	// maxInvItems is the maximum number of items in a single inventory
+	// announcement or data request.
+	maxInvItems = 1000
+	// maxKnownInv is the number of inventory items we remember per peer.
+	maxKnownInv = 10000
+	// getDataTimeout bounds how long fetching announced items can take.
+	getDataTimeout = 10 * time.Second
+)
+
+var (
+	ErrTooManyInvItems = errors.New("too many inventory items")
+	ErrUnknownCaller   = errors.New("call doesn't come from a known peer")
+)
+
+// invKey identifies an inventory item across types.
+func invKey(item *proto.InvItem) string {
+	return item.Type.String() + "_" + hex.EncodeToString(item.Hash)
+}
+
+// invSet is a bounded set of inventory keys, evicting the oldest ones.
+type invSet struct {
+	lock sync.Mutex
+	// keys maps every key to the generation it was added at, order lists
+	// the keys by generation. Removed keys are left in order and skipped
+	// on eviction, a key added again only matches its latest entry.
+	keys  map[string]uint64
+	order []invEntry
+	gen   uint64
+	max   int
+}
+
+type invEntry struct {
+	key string
+	gen uint64
+}
+
+func newInvSet(max int) *invSet {
+	return &invSet{
+		keys: make(map[string]uint64),
+		max:  max,
+	}
+}
+
+// Add inserts key and returns false if it was already in the set.
+func (s *invSet) Add(key string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.keys[key]; ok {
+		return false
+	}
+	for len(s.keys) >= s.max {
+		oldest := s.order[0]
+		s.order = s.order[1:]
+		if s.keys[oldest.key] == oldest.gen {
+			delete(s.keys, oldest.key)
+		}
+	}
+	s.gen++
+	s.keys[key] = s.gen
+	s.order = append(s.order, invEntry{key: key, gen: s.gen})
+	s.compact()
+	return true
+}
+
+// compact drops the entries of the removed keys from order once they make
+// up most of it.
+func (s *invSet) compact() {
+	if len(s.order) <= 2*s.max {
+		return
+	}
+	order := make([]invEntry, 0, len(s.keys))
+	for _, entry := range s.order {
+		if s.keys[entry.key] == entry.gen {
+			order = append(order, entry)
+		}
+	}
+	s.order = order
+}
+
+func (s *invSet) Has(key string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, ok := s.keys[key]
+	return ok
+}
+
+func (s *invSet) Remove(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.keys, key)
+}
+
+// HandleInv records what the announcing peer has and requests the bodies
+// of the items we are missing.
+func (n *Node) HandleInv(ctx context.Context, inv *proto.Inv) (*proto.Ack, error) {
+	id, ok := n.callerID(ctx)
+	if !ok {
+		return nil, ErrUnknownCaller
+	}
+	p, ok := n.peers.Get(id)
+	if !ok {
+		return nil, ErrUnknownCaller
+	}
+	if len(inv.Items) > maxInvItems {
+		n.penalize(id, penaltyProtocolViolation, ErrTooManyInvItems)
+		return nil, ErrTooManyInvItems
+	}
+
+	want := make([]*proto.InvItem, 0)
+	for _, item := range inv.Items {
+		key := invKey(item)
+		p.known.Add(key)
+		if n.haveInv(item) {
+			continue
+		}
+		// only fetch an item from the first peer announcing it
+		if !n.requested.Add(key) {
+			continue
+		}
+		want = append(want, item)
+	}
+	if len(want) > 0 {
+		n.spawn(func() { n.fetch(p, want) })
+	}
+
+	return &proto.Ack{}, nil
+}
+
+// GetData returns the bodies of the requested items we have.
+func (n *Node) GetData(ctx context.Context, inv *proto.Inv) (*proto.Data, error) {
+	if len(inv.Items) > maxInvItems {
+		n.misbehaving(ctx, penaltyProtocolViolation, ErrTooManyInvItems)
+		return nil, ErrTooManyInvItems
+	}
+	data := &proto.Data{}
+	for _, item := range inv.Items {
+		switch item.Type {
+		case proto.InvType_TX:
+			if tx, ok := n.mempool.Get(hex.EncodeToString(item.Hash)); ok {
+				data.Transactions = append(data.Transactions, tx)
+			}
+		case proto.InvType_BLOCK:
+			if b, err := n.chain.GetBlockByHash(item.Hash); err == nil {
+				data.Blocks = append(data.Blocks, b)
+			}
+		}
+	}
+	return data, nil
+}
+
+func (n *Node) haveInv(item *proto.InvItem) bool {
+	switch item.Type {
+	case proto.InvType_TX:
+		hash := hex.EncodeToString(item.Hash)
+		if _, ok := n.mempool.Get(hash); ok {
+			return true
+		}
+		_, err := n.chain.txStore.Get(hash)
+		return err == nil
+	case proto.InvType_BLOCK:
+		_, err := n.chain.GetBlockByHash(item.Hash)
+		return err == nil
+	}
+	return true
+}
+
+// fetch requests the bodies of items from the peer that announced them.
+func (n *Node) fetch(p *Peer, items []*proto.InvItem) {
+	defer func() {
+		for _, item := range items {
+			n.requested.Remove(invKey(item))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(n.ctx, getDataTimeout)
+	defer cancel()
+	data, err := p.client.GetData(ctx, &proto.Inv{Items: items})
+	if err != nil {
+		n.peerFailed(p, err)
+		return
+	}
+	n.peers.ReportSuccess(p.ID)
+
+	for _, tx := range data.Transactions {
+		if err := n.processTransaction(tx, p.ID); err != nil {
+			n.logger.Debugw("rejected transaction", "from", p.ID, "err", err)
+		}
+	}
+	for _, b := range data.Blocks {
+		if err := n.processBlock(b, p.ID); err != nil {
+			n.logger.Debugw("rejected block", "from", p.ID, "err", err)
+		}
+	}
+}
+
+// processTransaction admits tx into the mempool and announces it to the
+// peers that don't know about it yet. from is the ID of the peer we got it
+// from, if any, and gets penalized when tx is invalid.
+func (n *Node) processTransaction(tx *proto.Transaction, from string) error {
+	if !types.VerifyTransaction(tx) {
+		n.penalize(from, penaltyInvalidSignature, ErrInvalidTxSignature)
+		return ErrInvalidTxSignature
+	}
+	hash := types.HashTransaction(tx)
+	// a confirmed transaction would spend its outputs a second time
+	if _, err := n.chain.GetTransaction(hash); err == nil {
+		return ErrTxKnown
+	}
+	if err := n.mempool.Add(tx); err != nil {
+		if errors.Is(err, ErrTxTooLarge) {
+			n.penalize(from, penaltySpam, err)
+		}
+		return err
+	}
+
+	n.logger.Debugw("received transaction", "from", from, "hash", hex.EncodeToString(hash), "we", n.ListenAddr)
+	n.announce(&proto.InvItem{Type: proto.InvType_TX, Hash: hash})
+	return nil
+}
+
+// processBlock adds b to the chain and announces it. Only the blocks that
+// break the consensus rules get the peer penalized, the ones that don't
+// extend our tip or are off our clock may come from an honest peer.
+func (n *Node) processBlock(b *proto.Block, from string) error {
+	if err := n.chain.AddBlock(b); err != nil {
+		if isInvalidBlock(err) {
+			n.penalize(from, penaltyInvalidBlock, err)
+		}
+		return err
+	}
+	n.mempool.Remove(b.Transactions)
+
+	hash := types.HashBlock(b)
+	n.logger.Debugw("received block", "from", from, "height", b.Header.Height, "hash", hex.EncodeToString(hash))
+	n.announce(&proto.InvItem{Type: proto.InvType_BLOCK, Hash: hash})
+	return nil
+}
+
+// announce lets every peer that doesn't know about item yet know we have
+// it, in the background.
+func (n *Node) announce(item *proto.InvItem) {
+	n.spawn(func() {
+		if err := n.broadcast(&proto.Inv{Items: []*proto.InvItem{item}}); err != nil {
+			n.logger.Debugw("error announcing inventory", "err", err)
+		}
+	})
+}
+
+// broadcast sends the items of inv each peer doesn't know about yet to
+// every connected peer. A failing peer doesn't prevent the announcement
+// from reaching the others.
+func (n *Node) broadcast(inv *proto.Inv) error {
+	var (
+		peers  = n.peers.List()
+		failed = 0
+	)
+	for _, p := range peers {
+		items := make([]*proto.InvItem, 0, len(inv.Items))
+		for _, item := range inv.Items {
+			if p.known.Add(invKey(item)) {
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			continue
+		}
+		if !p.Supports(protocolInvGossip) {
+			if err := n.pushTransactions(p, items); err != nil {
+				failed++
+				n.peerFailed(p, err)
+			}
+			continue
+		}
+		if _, err := p.client.HandleInv(n.ctx, &proto.Inv{Items: items}); err != nil {
+			failed++
+			n.peerFailed(p, err)
+			continue
+		}
+		n.peers.ReportSuccess(p.ID)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to broadcast to %d out of %d peers", failed, len(peers))
+	}
+	return nil
+}
+
+// pushTransactions sends the bodies of the transactions in items to a peer
+// too old for inventory based gossip. Blocks can't be pushed to them.
+func (n *Node) pushTransactions(p *Peer, items []*proto.InvItem) error {
+	for _, item := range items {
+		if item.Type != proto.InvType_TX {
+			continue
+		}
+		tx, ok := n.mempool.Get(hex.EncodeToString(item.Hash))
+		if !ok {
+			continue
+		}
+		if _, err := p.client.HandleTransaction(n.ctx, tx); err != nil {
+			return err
+		}
+	}
+	n.peers.ReportSuccess(p.ID)
+	return nil
+}
@@ -0,0 +1,231 @@
+package node
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/types"
+	"github.com/vazj/blocker/util"
+)
+
+// signedTx returns a validly signed transaction with the given number of
+// outputs. Its inputs don't exist, which the mempool doesn't care about.
+func signedTx(outputs int) *proto.Transaction {
+	privKey := crypto.GeneratePrivateKey()
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{
+			{
+				PrevTxHash: util.RandomHash(),
+				PublicKey:  privKey.Public().Bytes(),
+			},
+		},
+	}
+	for i := 0; i < outputs; i++ {
+		tx.Outputs = append(tx.Outputs, &proto.TxOutput{
+			Amount:  int64(i + 1),
+			Address: privKey.Public().Address().Bytes(),
+		})
+	}
+	tx.Inputs[0].Signature = types.SignTransaction(privKey, tx).Bytes()
+	return tx
+}
+
+func txHash(tx *proto.Transaction) string {
+	return hex.EncodeToString(types.HashTransaction(tx))
+}
+
+func TestInvSet(t *testing.T) {
+	s := newInvSet(2)
+	assert.True(t, s.Add("a"))
+	assert.False(t, s.Add("a"))
+	assert.True(t, s.Add("b"))
+	assert.True(t, s.Add("c"))
+	// a got evicted
+	assert.False(t, s.Has("a"))
+	assert.True(t, s.Has("b"))
+	assert.True(t, s.Has("c"))
+	s.Remove("b")
+	assert.False(t, s.Has("b"))
+}
+
+func TestInvSetRemoveThenAdd(t *testing.T) {
+	s := newInvSet(2)
+	assert.True(t, s.Add("a"))
+	assert.True(t, s.Add("b"))
+	s.Remove("a")
+	assert.True(t, s.Add("a"))
+	// b is the oldest now, the stale entry of a doesn't evict it again
+	assert.True(t, s.Add("c"))
+	assert.False(t, s.Has("b"))
+	assert.True(t, s.Has("a"))
+	assert.True(t, s.Has("c"))
+
+	// removed keys don't pile up, nor evict the ones still there
+	s = newInvSet(2)
+	assert.True(t, s.Add("a"))
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint(i)
+		assert.True(t, s.Add(key))
+		s.Remove(key)
+	}
+	assert.LessOrEqual(t, len(s.order), 4)
+	assert.True(t, s.Has("a"))
+}
+
+func TestGossipTransaction(t *testing.T) {
+	nodeA, addrA := startNode(t, ServerConfig{})
+	nodeB, addrB := startNode(t, ServerConfig{MaxOutboundPeers: 1}, addrA)
+	nodeC, _ := startNode(t, ServerConfig{MaxOutboundPeers: 1}, addrB)
+	require.Eventually(t, func() bool {
+		return connected(nodeA, nodeB) && connected(nodeB, nodeC)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	tx := signedTx(1)
+	_, err := nodeA.HandleTransaction(context.Background(), tx)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		_, ok := nodeC.mempool.Get(txHash(tx))
+		return ok
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// B learned from A that it has the transaction and told C
+	p, ok := nodeB.peers.Get(nodeID(nodeA))
+	require.True(t, ok)
+	assert.True(t, p.known.Has(invKey(&proto.InvItem{Type: proto.InvType_TX, Hash: types.HashTransaction(tx)})))
+
+	// unsigned transactions are not accepted
+	_, err = nodeA.HandleTransaction(context.Background(), unsignedTx())
+	assert.ErrorIs(t, err, ErrInvalidTxSignature)
+}
+
+func TestGossipBlock(t *testing.T) {
+	nodeA, addrA := startNode(t, ServerConfig{PrivateKey: crypto.GeneratePrivateKey()})
+	nodeB, _ := startNode(t, ServerConfig{}, addrA)
+	require.Eventually(t, func() bool {
+		return connected(nodeA, nodeB)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	block, err := nodeA.buildBlock()
+	require.NoError(t, err)
+	require.NoError(t, nodeA.processBlock(block, ""))
+
+	require.Eventually(t, func() bool {
+		return nodeB.chain.Height() == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	fetched, err := nodeB.chain.GetBlockByHeight(1)
+	require.NoError(t, err)
+	assert.Equal(t, types.HashBlock(block), types.HashBlock(fetched))
+}
+
+func TestProcessInvalidBlock(t *testing.T) {
+	var (
+		node  = NewNode(ServerConfig{})
+		from  = hex.EncodeToString(crypto.GeneratePrivateKey().Public().Bytes())
+		chain = node.chain
+	)
+
+	// not building on our tip, the peer may just be out of sync
+	block := randomBlock(t, chain)
+	block.Header.PrevHash = util.RandomHash()
+	types.SignBlock(crypto.GeneratePrivateKey(), block)
+	assert.ErrorIs(t, node.processBlock(block, from), ErrInvalidPrevHash)
+	assert.Equal(t, 0, node.peers.Score(from))
+
+	// ahead of our clock, which may be the one that is off
+	block = randomBlock(t, chain)
+	block.Header.Timestamp = time.Now().Add(time.Hour).UnixNano()
+	types.SignBlock(crypto.GeneratePrivateKey(), block)
+	assert.ErrorIs(t, node.processBlock(block, from), ErrTimestampTooNew)
+	assert.Equal(t, 0, node.peers.Score(from))
+
+	block = randomBlock(t, chain)
+	block.Signature = make([]byte, crypto.SignatureLen)
+	assert.ErrorIs(t, node.processBlock(block, from), ErrInvalidBlockSignature)
+	assert.Equal(t, 0, node.peers.Score(from))
+	assert.True(t, node.bans.IsBanned(crypto.PublicKeyFromBytes(mustDecodeHex(t, from)).Bytes()))
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// TestGossipBandwidth checks that in a 20 node network announcing hashes
+// and fetching bodies on demand transfers a fraction of the bytes pushing
+// every transaction to every peer would.
+func TestGossipBandwidth(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping network test in short mode")
+	}
+
+	const (
+		numNodes = 20
+		numTxs   = 10
+	)
+	nodes := make([]*Node, 0, numNodes)
+	addrs := make([]string, 0, numNodes)
+	for i := 0; i < numNodes; i++ {
+		var bootstrap []string
+		if i > 0 {
+			bootstrap = []string{addrs[0], addrs[i-1]}
+		}
+		n, addr := startNode(t, ServerConfig{}, bootstrap...)
+		nodes = append(nodes, n)
+		addrs = append(addrs, addr)
+	}
+	require.Eventually(t, func() bool {
+		for _, n := range nodes {
+			if n.peers.Len() < 3 {
+				return false
+			}
+		}
+		return true
+	}, 20*time.Second, 100*time.Millisecond)
+
+	received := func() int64 {
+		total := int64(0)
+		for _, n := range nodes {
+			total += n.traffic.received.Load()
+		}
+		return total
+	}
+	before := received()
+
+	txs := make([]*proto.Transaction, numTxs)
+	txSize := 0
+	for i := range txs {
+		txs[i] = signedTx(50)
+		txSize += blockTxSize(txs[i])
+		_, err := nodes[i%numNodes].HandleTransaction(context.Background(), txs[i])
+		require.NoError(t, err)
+	}
+	require.Eventually(t, func() bool {
+		for _, n := range nodes {
+			if n.mempool.Len() != numTxs {
+				return false
+			}
+		}
+		return true
+	}, 10*time.Second, 50*time.Millisecond)
+	gossiped := received() - before
+
+	// flooding has every node push every transaction to all of its peers,
+	// so every connection carries each transaction in both directions.
+	links := 0
+	for _, n := range nodes {
+		links += n.peers.Len()
+	}
+	flooded := int64(links * txSize)
+	t.Logf("%d links, gossip received %d bytes, flooding would need %d", links, gossiped, flooded)
+	assert.Less(t, gossiped, flooded/3, fmt.Sprintf("expected less than a third of %d bytes", flooded))
+}
@@ -0,0 +1,130 @@
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/util"
+)
+
+const (
+	// challengeTTL is how long a handshake challenge can be answered for.
+	challengeTTL = 30 * time.Second
+	// maxChallenges bounds the challenges waiting for an answer, whatever
+	// the number of addresses asking for them.
+	maxChallenges = 10000
+)
+
+var ErrInvalidHandshake = errors.New("invalid handshake")
+
+// LoadOrCreateIdentity reads the hex encoded identity seed stored at path,
+// generating and storing a new one if the file doesn't exist yet.
+func LoadOrCreateIdentity(path string) (*crypto.PrivateKey, error) {
+	privKey, err := LoadKey(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		return privKey, err
+	}
+	privKey = crypto.GeneratePrivateKey()
+	if err := SaveKey(path, privKey); err != nil {
+		return nil, err
+	}
+	return privKey, nil
+}
+
+// LoadKey reads the hex encoded private key seed stored at path.
+func LoadKey(path string) (*crypto.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) != crypto.SeedLen {
+		return nil, errors.New("invalid key seed length")
+	}
+	return crypto.NewPrivateKeyFromSeed(seed), nil
+}
+
+// SaveKey stores the hex encoded seed of privKey at path, readable by the
+// owner only. It never overwrites an existing key.
+func SaveKey(path string, privKey *crypto.PrivateKey) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(hex.EncodeToString(privKey.Seed())); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// challengeStore keeps track of the nonces we handed out so every one of
+// them can be answered only once and only for a limited time. It holds at
+// most max of them, handing out a new one invalidates the oldest.
+type challengeStore struct {
+	lock   sync.Mutex
+	max    int
+	nonces map[string]time.Time
+	// order holds the nonces in the order they were issued, which is the
+	// order they expire in, consumed ones included until they are dropped.
+	order []string
+}
+
+func newChallengeStore(max int) *challengeStore {
+	return &challengeStore{
+		max:    max,
+		nonces: make(map[string]time.Time),
+	}
+}
+
+func (s *challengeStore) New() []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	for len(s.order) > 0 {
+		oldest := s.order[0]
+		expiry, ok := s.nonces[oldest]
+		if ok && now.Before(expiry) && len(s.nonces) < s.max {
+			break
+		}
+		delete(s.nonces, oldest)
+		s.order = s.order[1:]
+	}
+	if len(s.order) > 2*s.max {
+		order := make([]string, 0, len(s.nonces))
+		for _, key := range s.order {
+			if _, ok := s.nonces[key]; ok {
+				order = append(order, key)
+			}
+		}
+		s.order = order
+	}
+	nonce := util.RandomHash()
+	key := hex.EncodeToString(nonce)
+	s.nonces[key] = now.Add(challengeTTL)
+	s.order = append(s.order, key)
+	return nonce
+}
+
+// Consume reports whether nonce was issued by us and is still valid,
+// invalidating it in the process.
+func (s *challengeStore) Consume(nonce []byte) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := hex.EncodeToString(nonce)
+	expiry, ok := s.nonces[key]
+	delete(s.nonces, key)
+	return ok && time.Now().Before(expiry)
+}
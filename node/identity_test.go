@@ -0,0 +1,161 @@
+package node
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/types"
+	"github.com/vazj/blocker/util"
+	"google.golang.org/grpc/peer"
+)
+
+func TestLoadOrCreateIdentity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "identity.key")
+	privKey, err := LoadOrCreateIdentity(path)
+	require.NoError(t, err)
+
+	loaded, err := LoadOrCreateIdentity(path)
+	require.NoError(t, err)
+	assert.True(t, privKey.Equals(loaded))
+}
+
+func TestChallengeStore(t *testing.T) {
+	s := newChallengeStore(2)
+	nonce := s.New()
+	assert.False(t, s.Consume(util.RandomHash()))
+	assert.True(t, s.Consume(nonce))
+	// a challenge can only be answered once
+	assert.False(t, s.Consume(nonce))
+
+	// the oldest challenges are dropped once the store is full
+	a, b, c := s.New(), s.New(), s.New()
+	assert.False(t, s.Consume(a))
+	assert.True(t, s.Consume(b))
+	assert.True(t, s.Consume(c))
+
+	// answered challenges don't pile up
+	for i := 0; i < 100; i++ {
+		assert.True(t, s.Consume(s.New()))
+	}
+	assert.LessOrEqual(t, len(s.order), 2*s.max+1)
+	assert.Empty(t, s.nonces)
+}
+
+func TestHandshakeRejectsInvalidVersions(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		node     = NewNode(ServerConfig{ListenAddr: freeAddr(t)})
+		identity = crypto.GeneratePrivateKey()
+	)
+
+	signedVersion := func(nonce []byte) *proto.Version {
+		v := &proto.Version{ListenAddr: freeAddr(t), Nonce: nonce, ProtocolVersion: ProtocolVersion}
+		types.SignVersion(identity, v)
+		return v
+	}
+
+	// not answering a challenge we issued
+	_, err := node.Handshake(ctx, signedVersion(util.RandomHash()))
+	assert.ErrorIs(t, err, ErrInvalidHandshake)
+
+	// tampered after signing
+	challenge, err := node.GetChallenge(ctx, &proto.Ack{})
+	require.NoError(t, err)
+	v := signedVersion(challenge.Nonce)
+	v.ListenAddr = ":1234"
+	_, err = node.Handshake(ctx, v)
+	assert.ErrorIs(t, err, ErrInvalidHandshake)
+
+	// speaking a protocol version that is too old
+	challenge, err = node.GetChallenge(ctx, &proto.Ack{})
+	require.NoError(t, err)
+	v = signedVersion(challenge.Nonce)
+	v.ProtocolVersion = MinProtocolVersion - 1
+	types.SignVersion(identity, v)
+	_, err = node.Handshake(ctx, v)
+	assert.ErrorIs(t, err, ErrIncompatibleVersion)
+
+	// banned identity
+	node.bans.Ban(identity.Public().Bytes(), time.Hour)
+	challenge, err = node.GetChallenge(ctx, &proto.Ack{})
+	require.NoError(t, err)
+	_, err = node.Handshake(ctx, signedVersion(challenge.Nonce))
+	assert.ErrorIs(t, err, ErrBannedPeer)
+	assert.Equal(t, 0, node.peers.Len())
+}
+
+func TestHandshakeRejectsForeignListenAddr(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		addrA = freeAddr(t)
+		addrB = freeAddr(t)
+		nodeA = NewNode(ServerConfig{})
+		nodeB = NewNode(ServerConfig{})
+	)
+	go nodeB.Start(addrB, []string{})
+	time.Sleep(100 * time.Millisecond)
+
+	// an identity claiming to listen on the address of nodeB
+	identity := crypto.GeneratePrivateKey()
+	challenge, err := nodeA.GetChallenge(ctx, &proto.Ack{})
+	require.NoError(t, err)
+	v := &proto.Version{ListenAddr: addrB, Nonce: challenge.Nonce, ProtocolVersion: ProtocolVersion}
+	types.SignVersion(identity, v)
+
+	nodeA.ListenAddr = addrA
+	_, err = nodeA.Handshake(ctx, v)
+	assert.ErrorIs(t, err, ErrInvalidHandshake)
+	assert.Equal(t, 0, nodeA.peers.Len())
+}
+
+func TestHandshakeHostlessListenAddr(t *testing.T) {
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("no IPv6 loopback")
+	}
+	addrA := ln.Addr().String()
+	ln.Close()
+
+	// nodeA only listens on the IPv6 loopback and advertises no host, as
+	// a node listening on all the interfaces of another machine does.
+	var (
+		ctx   = context.Background()
+		nodeA = NewNode(ServerConfig{})
+		nodeB = NewNode(ServerConfig{ListenAddr: freeAddr(t)})
+	)
+	go nodeA.Start(addrA, []string{})
+	t.Cleanup(func() { nodeA.Stop(ctx) })
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addrA)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, time.Second, 10*time.Millisecond)
+
+	challenge, err := nodeB.GetChallenge(ctx, &proto.Ack{})
+	require.NoError(t, err)
+	v := &proto.Version{
+		ListenAddr:      ":" + strings.TrimPrefix(addrA, "[::1]:"),
+		Nonce:           challenge.Nonce,
+		ProtocolVersion: ProtocolVersion,
+	}
+	types.SignVersion(nodeA.IdentityKey, v)
+
+	from := &net.TCPAddr{IP: net.IPv6loopback, Port: 40000}
+	_, err = nodeB.Handshake(peer.NewContext(ctx, &peer.Peer{Addr: from}), v)
+	require.NoError(t, err)
+	p, ok := nodeB.peers.Get(nodeID(nodeA))
+	require.True(t, ok)
+	assert.Equal(t, addrA, p.version.ListenAddr)
+	p.Close()
+}
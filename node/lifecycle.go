@@ -0,0 +1,85 @@
+package node
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+)
+
+var ErrNodeStopped = errors.New("node is stopped")
+
+// spawn runs f in a goroutine Stop waits for. Nothing is started once the
+// node is stopping, as f would be cut short by the cancelled context anyway.
+func (n *Node) spawn(f func()) {
+	n.lifecycle.Lock()
+	defer n.lifecycle.Unlock()
+	if n.stopped {
+		return
+	}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		f()
+	}()
+}
+
+// serve registers s so Stop shuts it down. It fails when the node is
+// already stopped.
+func (n *Node) serve(s *grpc.Server) error {
+	n.lifecycle.Lock()
+	defer n.lifecycle.Unlock()
+	if n.stopped {
+		return ErrNodeStopped
+	}
+	n.servers = append(n.servers, s)
+	return nil
+}
+
+// Stop shuts the node down: it stops accepting connections, lets the
+// in-flight calls finish, halts the validator, discovery and health loops,
+// closes the peer connections and flushes the address book and stores.
+// When ctx expires before the calls and loops are done, the remaining
+// connections are closed forcefully and ctx's error is returned.
+func (n *Node) Stop(ctx context.Context) error {
+	n.lifecycle.Lock()
+	if n.stopped {
+		n.lifecycle.Unlock()
+		return ErrNodeStopped
+	}
+	n.stopped = true
+	servers := n.servers
+	n.lifecycle.Unlock()
+
+	n.logger.Infow("stopping node...", "port", n.ListenAddr)
+	n.cancel()
+
+	drained := make(chan struct{})
+	go func() {
+		for _, s := range servers {
+			s.GracefulStop()
+		}
+		n.wg.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		for _, s := range servers {
+			s.Stop()
+		}
+		err = ctx.Err()
+	}
+
+	n.peers.Clear()
+	if saveErr := n.addrBook.Save(); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	if closeErr := n.chain.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	n.logger.Infow("node stopped", "port", n.ListenAddr)
+	return err
+}
@@ -0,0 +1,63 @@
+package node
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vazj/blocker/crypto"
+)
+
+func TestStopNode(t *testing.T) {
+	var (
+		addrA   = freeAddr(t)
+		nodeA   = NewNode(ServerConfig{PrivateKey: crypto.GeneratePrivateKey(), AdminAddr: freeAddr(t)})
+		stopped = make(chan error)
+	)
+	go func() {
+		stopped <- nodeA.Start(addrA, nil)
+	}()
+	nodeB, _ := startNode(t, ServerConfig{}, addrA)
+	require.Eventually(t, func() bool {
+		return connected(nodeA, nodeB)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, nodeA.Stop(ctx))
+
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Start didn't return after Stop")
+	}
+	assert.Equal(t, 0, nodeA.peers.Len())
+	for _, addr := range []string{addrA, nodeA.AdminAddr} {
+		_, err := net.Dial("tcp", addr)
+		assert.Error(t, err)
+	}
+
+	// nodeB notices that nodeA went away
+	p, ok := nodeB.peers.Get(nodeID(nodeA))
+	require.True(t, ok)
+	for i := 0; i < maxPeerFailures; i++ {
+		nodeB.ping(p)
+	}
+	assert.Equal(t, 0, nodeB.peers.Len())
+
+	assert.ErrorIs(t, nodeA.Stop(ctx), ErrNodeStopped)
+	assert.ErrorIs(t, nodeA.Start(freeAddr(t), nil), ErrNodeStopped)
+}
+
+func TestStopBeforeStart(t *testing.T) {
+	node := NewNode(ServerConfig{})
+	require.NoError(t, node.Stop(context.Background()))
+	assert.ErrorIs(t, node.Start(freeAddr(t), nil), ErrNodeStopped)
+	// nothing gets started once stopped
+	node.announce(randomInv().Items[0])
+	node.wg.Wait()
+}
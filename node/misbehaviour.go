@@ -0,0 +1,147 @@
+package node
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	// banThreshold is the misbehaviour score at which a peer gets banned.
+	banThreshold = 100
+	// defaultBanDuration is how long misbehaving peers are banned for.
+	defaultBanDuration = 24 * time.Hour
+
+	penaltyInvalidBlock      = 100
+	penaltyInvalidSignature  = 50
+	penaltyProtocolViolation = 20
+	penaltySpam              = 10
+)
+
+// invalidBlockErrors are the errors of blocks that break the consensus
+// rules whatever the state of the node checking them. Blocks that don't
+// extend our tip or whose timestamp is off may be relayed by honest peers,
+// out of sync or with another clock, and go unpunished.
+var invalidBlockErrors = []error{
+	ErrInvalidBlockSignature,
+	ErrUnsupportedVersion,
+	ErrBlockTooLarge,
+	ErrTooManyTxs,
+	ErrTxTooLarge,
+	ErrInvalidTxSignature,
+	ErrUTXONotFound,
+	ErrOutputSpent,
+	ErrDoubleSpend,
+	ErrInputNotOwned,
+	ErrInvalidAmount,
+	ErrInsufficientBalance,
+}
+
+// isInvalidBlock tells whether err, returned when adding a block, proves
+// the block invalid.
+func isInvalidBlock(err error) bool {
+	for _, target := range invalidBlockErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	ErrBannedPeer         = errors.New("peer is banned")
+	ErrInvalidTxSignature = errors.New("transaction's signature is invalid")
+)
+
+// BanList holds the identities we refuse to peer with until their ban
+// expires.
+type BanList struct {
+	lock   sync.RWMutex
+	banned map[string]time.Time
+}
+
+func NewBanList() *BanList {
+	return &BanList{
+		banned: make(map[string]time.Time),
+	}
+}
+
+func (b *BanList) Ban(pubKey []byte, d time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.banned[hex.EncodeToString(pubKey)] = time.Now().Add(d)
+}
+
+func (b *BanList) Unban(pubKey []byte) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.banned, hex.EncodeToString(pubKey))
+}
+
+func (b *BanList) IsBanned(pubKey []byte) bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	until, ok := b.banned[hex.EncodeToString(pubKey)]
+	return ok && time.Now().Before(until)
+}
+
+// List returns when the ban of every banned identity expires, by hex
+// encoded public key. Expired bans are dropped along the way.
+func (b *BanList) List() map[string]time.Time {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	bans := make(map[string]time.Time, len(b.banned))
+	for id, until := range b.banned {
+		if now.After(until) {
+			delete(b.banned, id)
+			continue
+		}
+		bans[id] = until
+	}
+	return bans
+}
+
+// callerID returns the ID of the peer behind an incoming call, if the
+// connection it came over was authenticated.
+func (n *Node) callerID(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "", false
+	}
+	return n.peers.ConnPeerID(p.Addr.String())
+}
+
+// misbehaving penalizes the peer behind an incoming call, if it is known.
+func (n *Node) misbehaving(ctx context.Context, penalty int, reason error) {
+	if id, ok := n.callerID(ctx); ok {
+		n.penalize(id, penalty, reason)
+	}
+}
+
+// penalize increases the score of the peer with the given ID by penalty
+// and bans it once it crosses banThreshold. An empty ID is ignored.
+func (n *Node) penalize(id string, penalty int, reason error) {
+	if id == "" {
+		return
+	}
+	score := n.peers.AddScore(id, penalty)
+	n.logger.Infow("peer misbehaving", "peer", id, "score", score, "reason", reason)
+	if score >= banThreshold {
+		pubKey, _ := hex.DecodeString(id)
+		n.banPeer(pubKey, defaultBanDuration)
+	}
+}
+
+// banPeer bans the identity for d and disconnects it.
+func (n *Node) banPeer(pubKey []byte, d time.Duration) {
+	id := hex.EncodeToString(pubKey)
+	n.bans.Ban(pubKey, d)
+	n.peers.Remove(id)
+	n.peers.ResetScore(id)
+	n.logger.Infow("peer banned", "peer", id, "duration", d)
+}
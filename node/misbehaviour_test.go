@@ -0,0 +1,121 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/proto"
+)
+
+func TestBanList(t *testing.T) {
+	var (
+		bans   = NewBanList()
+		pubKey = crypto.GeneratePrivateKey().Public().Bytes()
+	)
+	assert.False(t, bans.IsBanned(pubKey))
+	bans.Ban(pubKey, time.Hour)
+	assert.True(t, bans.IsBanned(pubKey))
+	assert.Len(t, bans.List(), 1)
+	bans.Unban(pubKey)
+	assert.False(t, bans.IsBanned(pubKey))
+
+	bans.Ban(pubKey, -time.Second)
+	assert.False(t, bans.IsBanned(pubKey))
+	assert.Empty(t, bans.List())
+}
+
+// unsignedTx returns a transaction with an invalid signature.
+func unsignedTx() *proto.Transaction {
+	tx := randomTx()
+	tx.Inputs[0].PublicKey = crypto.GeneratePrivateKey().Public().Bytes()
+	tx.Inputs[0].Signature = make([]byte, crypto.SignatureLen)
+	return tx
+}
+
+func TestBanMisbehavingPeer(t *testing.T) {
+	// B dialed A, so it talks to A over the connection it handshaked on,
+	// while A talks to B over the one it identified itself on. Both have to
+	// be attributed to the sender.
+	for _, fromDialer := range []bool{true, false} {
+		nodeA, addrA := startNode(t, ServerConfig{})
+		nodeB, _ := startNode(t, ServerConfig{}, addrA)
+		require.Eventually(t, func() bool {
+			return connected(nodeA, nodeB)
+		}, 2*time.Second, 10*time.Millisecond)
+
+		sender, receiver := nodeB, nodeA
+		if !fromDialer {
+			sender, receiver = nodeA, nodeB
+		}
+		p, ok := sender.peers.Get(nodeID(receiver))
+		require.True(t, ok)
+
+		_, err := p.client.HandleTransaction(context.Background(), unsignedTx())
+		require.ErrorContains(t, err, ErrInvalidTxSignature.Error())
+		assert.Equal(t, penaltyInvalidSignature, receiver.peers.Score(nodeID(sender)))
+		_, err = p.client.HandleTransaction(context.Background(), unsignedTx())
+		require.Error(t, err)
+
+		assert.True(t, receiver.bans.IsBanned(sender.IdentityKey.Public().Bytes()))
+		_, ok = receiver.peers.Get(nodeID(sender))
+		assert.False(t, ok)
+		assert.Equal(t, 0, receiver.peers.Score(nodeID(sender)))
+	}
+}
+
+func TestBannedPeerCantReconnect(t *testing.T) {
+	nodeA, addrA := startNode(t, ServerConfig{})
+	nodeB := NewNode(ServerConfig{ListenAddr: freeAddr(t)})
+	nodeA.bans.Ban(nodeB.IdentityKey.Public().Bytes(), time.Hour)
+
+	err := nodeB.connect(addrA)
+	assert.ErrorContains(t, err, ErrBannedPeer.Error())
+	assert.Equal(t, 0, nodeA.peers.Len())
+}
+
+func TestAdminServer(t *testing.T) {
+	var (
+		ctx          = context.Background()
+		adminAddr    = freeAddr(t)
+		nodeA, addrA = startNode(t, ServerConfig{AdminAddr: adminAddr})
+		nodeB, _     = startNode(t, ServerConfig{}, addrA)
+	)
+	require.Eventually(t, func() bool {
+		return connected(nodeA, nodeB)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	conn, _, err := nodeB.makeNodeClient(adminAddr)
+	require.NoError(t, err)
+	defer conn.Close()
+	admin := proto.NewAdminClient(conn)
+
+	var list *proto.PeerInfoList
+	require.Eventually(t, func() bool {
+		list, err = admin.ListPeers(ctx, &proto.Ack{})
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	require.Len(t, list.Peers, 1)
+	assert.Equal(t, nodeB.IdentityKey.Public().Bytes(), list.Peers[0].PublicKey)
+	assert.False(t, list.Peers[0].Outbound)
+	assert.Empty(t, list.Bans)
+
+	pubKeyB := nodeB.IdentityKey.Public().Bytes()
+	_, err = admin.BanPeer(ctx, &proto.BanRequest{PublicKey: pubKeyB, Duration: int64(time.Hour)})
+	require.NoError(t, err)
+	list, err = admin.ListPeers(ctx, &proto.Ack{})
+	require.NoError(t, err)
+	assert.Empty(t, list.Peers)
+	require.Len(t, list.Bans, 1)
+	assert.Equal(t, pubKeyB, list.Bans[0].PublicKey)
+
+	_, err = admin.UnbanPeer(ctx, &proto.BanRequest{PublicKey: pubKeyB})
+	require.NoError(t, err)
+	assert.False(t, nodeA.bans.IsBanned(pubKeyB))
+
+	_, err = admin.BanPeer(ctx, &proto.BanRequest{PublicKey: []byte("short")})
+	assert.Error(t, err)
+}
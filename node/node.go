@@ -1,31 +1,68 @@
 package node
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 
 	"encoding/hex"
 	"net"
 	"sync"
 	"time"
 
+	pb "github.com/golang/protobuf/proto"
 	"github.com/vazj/blocker/crypto"
 	"github.com/vazj/blocker/proto"
 	"github.com/vazj/blocker/types"
+	"github.com/vazj/blocker/util"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/peer"
 )
 
 const blockTime = time.Second * 5
 
+var (
+	ErrTxKnown    = errors.New("transaction already in the mempool")
+	ErrTxConflict = errors.New("transaction spends an output a pending one already spends")
+)
+
 type Mempool struct {
 	lock sync.RWMutex
 	txx  map[string]*proto.Transaction
+	// spent maps the outputs the transactions of the pool spend, by key,
+	// to the hash of the transaction spending them.
+	spent      map[string]string
+	maxTxBytes int
 }
 
-func NewMempool() *Mempool {
+func NewMempool(maxTxBytes int) *Mempool {
 	return &Mempool{
-		txx: make(map[string]*proto.Transaction),
+		txx:        make(map[string]*proto.Transaction),
+		spent:      make(map[string]string),
+		maxTxBytes: maxTxBytes,
+	}
+}
+
+func inputKey(input *proto.TxInput) string {
+	return utxoKey(hex.EncodeToString(input.PrevTxHash), int(input.PrevOutIndex))
+}
+
+// remove drops the transaction with the given hash and releases the outputs
+// it spends.
+func (m *Mempool) remove(hash string) {
+	tx, ok := m.txx[hash]
+	if !ok {
+		return
+	}
+	delete(m.txx, hash)
+	for _, input := range tx.Inputs {
+		if key := inputKey(input); m.spent[key] == hash {
+			delete(m.spent, key)
+		}
 	}
 }
 
@@ -43,6 +80,7 @@ func (m *Mempool) Clear() []*proto.Transaction {
 	}
 	//maps.Clear(m.txx)
 	//m.txx = make(map[string]*proto.Transaction)
+	m.spent = make(map[string]string)
 
 	for _, tx := range m.txx {
 		txs = append(txs, tx)
@@ -57,6 +95,44 @@ func (m *Mempool) Len() int {
 	return len(m.txx)
 }
 
+// Get returns the transaction with the given hex encoded hash.
+func (m *Mempool) Get(hash string) (*proto.Transaction, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	tx, ok := m.txx[hash]
+	return tx, ok
+}
+
+// List returns up to max transactions of the mempool, leaving them in.
+func (m *Mempool) List(max int) []*proto.Transaction {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	txs := make([]*proto.Transaction, 0)
+	for _, tx := range m.txx {
+		if len(txs) >= max {
+			break
+		}
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+// Remove drops txs from the mempool, usually because they made it into a
+// block, along with the transactions spending the same outputs, which can't
+// make it anymore.
+func (m *Mempool) Remove(txs []*proto.Transaction) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, tx := range txs {
+		m.remove(hex.EncodeToString(types.HashTransaction(tx)))
+		for _, input := range tx.Inputs {
+			if other, ok := m.spent[inputKey(input)]; ok {
+				m.remove(other)
+			}
+		}
+	}
+}
+
 func (m *Mempool) Has(tx *proto.Transaction) bool {
 	m.lock.RLock()
 	defer m.lock.RUnlock()
@@ -64,29 +140,115 @@ func (m *Mempool) Has(tx *proto.Transaction) bool {
 	return ok
 }
 
-func (m *Mempool) Add(tx *proto.Transaction) bool {
-	if m.Has(tx) {
-		return false
+// Add admits tx into the mempool. It returns ErrTxKnown if tx is already
+// in the mempool, ErrTxConflict if it spends an output another transaction
+// of the mempool spends and ErrTxTooLarge if it could never fit in a block.
+func (m *Mempool) Add(tx *proto.Transaction) error {
+	if size := pb.Size(tx); size > m.maxTxBytes {
+		return fmt.Errorf("%w: got %d bytes, max %d", ErrTxTooLarge, size, m.maxTxBytes)
 	}
+	hash := hex.EncodeToString(types.HashTransaction(tx))
 	m.lock.Lock()
 	defer m.lock.Unlock()
-	m.txx[hex.EncodeToString(types.HashTransaction(tx))] = tx
-	return true
+	if _, ok := m.txx[hash]; ok {
+		return ErrTxKnown
+	}
+	for _, input := range tx.Inputs {
+		if other, ok := m.spent[inputKey(input)]; ok {
+			return fmt.Errorf("%w: %s", ErrTxConflict, other)
+		}
+	}
+	m.txx[hash] = tx
+	for _, input := range tx.Inputs {
+		m.spent[inputKey(input)] = hash
+	}
+	return nil
+}
+
+// Take removes and returns up to maxTxs transactions whose combined size
+// once embedded in a block doesn't exceed maxBytes. Transactions that
+// don't fit are left in the mempool for the next block.
+func (m *Mempool) Take(maxTxs, maxBytes int) []*proto.Transaction {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	txs := make([]*proto.Transaction, 0)
+	size := 0
+	for k, tx := range m.txx {
+		if len(txs) >= maxTxs {
+			break
+		}
+		txSize := blockTxSize(tx)
+		if size+txSize > maxBytes {
+			continue
+		}
+		size += txSize
+		txs = append(txs, tx)
+		m.remove(k)
+	}
+	return txs
 }
 
 type ServerConfig struct {
 	Version    string
 	ListenAddr string
+	// PrivateKey is the key blocks are signed with, only set on validators.
 	PrivateKey *crypto.PrivateKey
+	// IdentityKey authenticates the node to its peers. A random one is
+	// generated when it isn't set, see LoadOrCreateIdentity to persist it.
+	IdentityKey     *crypto.PrivateKey
+	TLS             TLSConfig
+	ConsensusParams ConsensusParams
+	// AddrBookFile is where the addresses of known nodes are persisted.
+	// The address book is kept in memory only when it is empty.
+	AddrBookFile string
+	// MinOutboundPeers is the number of outbound peers below which we look
+	// for new peers more aggressively.
+	MinOutboundPeers int
+	// MaxOutboundPeers is the number of peers we dial ourselves.
+	MaxOutboundPeers int
+	// MaxInboundPeers is the number of peers we accept connections from.
+	MaxInboundPeers int
+	// AdminAddr is the address the admin service listens on, which should
+	// be a local one. The admin service is disabled when it is empty.
+	AdminAddr string
+	// RateLimits bound the requests callers can make to the node service.
+	RateLimits RateLimits
+	// Services are the optional services advertised to peers. ServiceFullNode
+	// is always advertised, and ServiceValidator when PrivateKey is set.
+	Services Services
+	// Genesis is the first block of the chain, the built-in one when nil.
+	Genesis *proto.Block
+	// LogLevel is the minimum level of the logs, info by default.
+	LogLevel zapcore.Level
 }
 
 type Node struct {
 	ServerConfig
 	logger *zap.SugaredLogger
 
-	peerLock sync.RWMutex
-	peers    map[proto.NodeClient]*proto.Version
-	mempool  *Mempool
+	// ctx is cancelled when the node stops, which halts its loops and the
+	// calls it makes to its peers.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// wg tracks the goroutines started with spawn.
+	wg sync.WaitGroup
+	// lifecycle guards stopped and servers.
+	lifecycle sync.Mutex
+	stopped   bool
+	servers   []*grpc.Server
+
+	peers    *PeerManager
+	addrBook *AddrBook
+	// requested holds the inventory items being fetched from peers.
+	requested  *invSet
+	traffic    *trafficStats
+	limiter    *requestLimiter
+	bans       *BanList
+	challenges *challengeStore
+	mempool    *Mempool
+	chain      *Chain
+	// clientCreds secure the connections we dial, nil means plaintext.
+	clientCreds credentials.TransportCredentials
 
 	proto.UnimplementedNodeServer
 }
@@ -94,162 +256,443 @@ type Node struct {
 func NewNode(cfg ServerConfig) *Node {
 	loggerConfig := zap.NewProductionConfig()
 	loggerConfig.DisableCaller = true
-	loggerConfig.Level.SetLevel(zap.DebugLevel)
+	loggerConfig.Level.SetLevel(cfg.LogLevel)
 	logger, _ := loggerConfig.Build()
+	if cfg.ConsensusParams == (ConsensusParams{}) {
+		cfg.ConsensusParams = DefaultConsensusParams()
+	}
+	if cfg.IdentityKey == nil {
+		cfg.IdentityKey = crypto.GeneratePrivateKey()
+	}
+	if cfg.MinOutboundPeers == 0 {
+		cfg.MinOutboundPeers = defaultMinOutboundPeers
+	}
+	if cfg.MaxOutboundPeers == 0 {
+		cfg.MaxOutboundPeers = defaultMaxOutboundPeers
+	}
+	if cfg.MaxInboundPeers == 0 {
+		cfg.MaxInboundPeers = defaultMaxInboundPeers
+	}
+	cfg.RateLimits = cfg.RateLimits.withDefaults(cfg.ConsensusParams)
+	if cfg.Genesis == nil {
+		cfg.Genesis = createGenesisBlock()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Node{
-		peers:        make(map[proto.NodeClient]*proto.Version),
+		ctx:          ctx,
+		cancel:       cancel,
+		peers:        NewPeerManager(),
+		addrBook:     NewAddrBook(cfg.AddrBookFile),
+		requested:    newInvSet(maxKnownInv),
+		traffic:      &trafficStats{},
+		limiter:      newRequestLimiter(cfg.RateLimits),
+		bans:         NewBanList(),
+		challenges:   newChallengeStore(maxChallenges),
 		logger:       logger.Sugar(),
-		mempool:      NewMempool(),
+		mempool:      NewMempool(cfg.ConsensusParams.MaxTxBytes),
+		chain:        NewChainWithGenesis(cfg.Genesis, cfg.ConsensusParams, NewMemoryBlockStore(), NewMemoryTXStore()),
 		ServerConfig: cfg,
 	}
 }
 
 func (n *Node) Start(listenAddr string, boostrapnodes []string) error {
 	n.ListenAddr = listenAddr
-	var (
-		opts       = []grpc.ServerOption{}
-		grpcServer = grpc.NewServer(opts...)
-	)
+	opts := append(n.serverOptions(), grpc.StatsHandler(n.traffic))
+	if n.TLS.Enabled {
+		serverCreds, clientCreds, err := n.TLS.credentials(n.IdentityKey)
+		if err != nil {
+			return err
+		}
+		n.clientCreds = clientCreds
+		opts = append(opts, grpc.Creds(serverCreds))
+	}
+	if err := n.addrBook.Load(); err != nil {
+		return err
+	}
+	grpcServer := grpc.NewServer(opts...)
+	proto.RegisterNodeServer(grpcServer, n)
+	proto.RegisterQueryServer(grpcServer, NewQueryServer(n))
+	if err := n.serve(grpcServer); err != nil {
+		return err
+	}
 	ln, err := net.Listen("tcp", listenAddr)
 	if err != nil {
-		n.logger.Fatal(err)
+		return err
 	}
-	proto.RegisterNodeServer(grpcServer, n)
 	n.logger.Infow("node started...", "port", n.ListenAddr)
 
+	if n.AdminAddr != "" {
+		if err := n.serveAdmin(); err != nil {
+			ln.Close()
+			return err
+		}
+	}
+
 	// bootstrap network with a list of already know nodes
-	if len(boostrapnodes) > 0 {
-		go n.bootstrapNetwork(boostrapnodes)
+	for _, addr := range boostrapnodes {
+		n.addrBook.Add(addr)
 	}
+	n.spawn(n.discoveryLoop)
 
 	if n.PrivateKey != nil {
-		go n.validatorLoop()
+		n.spawn(n.validatorLoop)
 	}
 
-	return grpcServer.Serve(ln)
+	n.spawn(n.healthLoop)
+
+	if err := grpcServer.Serve(ln); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
 }
 
 func (n *Node) GetVersion() string {
 	return n.Version
 }
 
+// GetChallenge hands out a nonce the caller has to sign in its handshake.
+func (n *Node) GetChallenge(ctx context.Context, _ *proto.Ack) (*proto.Challenge, error) {
+	return &proto.Challenge{Nonce: n.challenges.New()}, nil
+}
+
+// Identify proves we own our identity key by signing the given nonce. When
+// the caller answers one of our challenges along the way, the connection
+// the call came over is bound to its identity.
+func (n *Node) Identify(ctx context.Context, c *proto.Challenge) (*proto.Version, error) {
+	if c.Version != nil {
+		if err := n.authenticateCaller(ctx, c.Version); err != nil {
+			return nil, err
+		}
+	}
+	return n.getVersion(c.Nonce), nil
+}
+
 func (n *Node) Handshake(ctx context.Context, v *proto.Version) (*proto.Version, error) {
-	c, err := makeNodeClient(v.ListenAddr)
-	if err != nil {
+	if err := n.authenticateCaller(ctx, v); err != nil {
 		return nil, err
 	}
-	n.addPeer(c, v)
 
-	return n.getVersion(), nil
+	if _, ok := n.peers.Get(peerID(v)); !ok {
+		if n.peers.Inbound() >= n.MaxInboundPeers {
+			return nil, ErrTooManyPeers
+		}
+		// a peer listening on all of its interfaces advertises no host, it
+		// is reachable on the one it called us from
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			v.ListenAddr = resolveAddr(v.ListenAddr, hostOf(p.Addr.String()))
+		}
+		conn, c, err := n.makeNodeClient(v.ListenAddr)
+		if err != nil {
+			return nil, err
+		}
+		// make sure the address we were given belongs to the same identity
+		// before we start gossiping with it.
+		if err := n.identify(ctx, c, v.PublicKey); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		n.addrBook.MarkGood(v.ListenAddr)
+		n.addPeer(NewPeer(conn, c, v, false))
+	}
+
+	return n.getVersion(v.Challenge), nil
 }
 
-func (n *Node) HandleTransaction(ctx context.Context, tx *proto.Transaction) (*proto.Ack, error) {
-	if n.mempool.Add(tx) {
-		peer, _ := peer.FromContext(ctx)
-		hash := hex.EncodeToString(types.HashTransaction(tx))
-		n.logger.Debugw("received transaction", "from", peer.Addr, "hash", hash, "we", n.ListenAddr)
-		go func() {
-			if err := n.broadcast(tx); err != nil {
-				n.logger.Errorw("error broadcasting transaction", "err", err)
-			}
-		}()
+// authenticateCaller verifies that v answers one of our challenges and
+// binds the connection of the incoming call to the identity of v.
+func (n *Node) authenticateCaller(ctx context.Context, v *proto.Version) error {
+	if !n.challenges.Consume(v.Nonce) {
+		return fmt.Errorf("%w: unknown or expired challenge", ErrInvalidHandshake)
+	}
+	if err := n.checkVersion(v, v.Nonce); err != nil {
+		return err
 	}
+	p, _ := peer.FromContext(ctx)
+	if err := n.TLS.checkPeerIdentity(p, v.PublicKey); err != nil {
+		return err
+	}
+	if p != nil && p.Addr != nil {
+		n.peers.BindConn(p.Addr.String(), peerID(v))
+	}
+	return nil
+}
+
+// checkVersion verifies the identity claimed in v, which has to be an
+// answer to nonce.
+func (n *Node) checkVersion(v *proto.Version, nonce []byte) error {
+	if len(nonce) == 0 || !bytes.Equal(v.Nonce, nonce) {
+		return fmt.Errorf("%w: version doesn't answer our challenge", ErrInvalidHandshake)
+	}
+	if !types.VerifyVersion(v) {
+		return fmt.Errorf("%w: invalid signature", ErrInvalidHandshake)
+	}
+	if err := checkProtocolVersion(v.ProtocolVersion); err != nil {
+		return err
+	}
+	if bytes.Equal(v.PublicKey, n.IdentityKey.Public().Bytes()) {
+		return fmt.Errorf("%w: peer has our own identity", ErrInvalidHandshake)
+	}
+	if n.bans.IsBanned(v.PublicKey) {
+		return ErrBannedPeer
+	}
+	return nil
+}
 
+// identify challenges the node behind c to prove it owns pubKey, while
+// authenticating ourselves over the same connection.
+func (n *Node) identify(ctx context.Context, c proto.NodeClient, pubKey []byte) error {
+	challenge, err := c.GetChallenge(ctx, &proto.Ack{})
+	if err != nil {
+		return err
+	}
+	var (
+		nonce = util.RandomHash()
+		p     peer.Peer
+	)
+	v, err := c.Identify(ctx, &proto.Challenge{Nonce: nonce, Version: n.getVersion(challenge.Nonce)}, grpc.Peer(&p))
+	if err != nil {
+		return err
+	}
+	if err := n.checkVersion(v, nonce); err != nil {
+		return err
+	}
+	if err := n.TLS.checkPeerIdentity(&p, v.PublicKey); err != nil {
+		return err
+	}
+	if !bytes.Equal(v.PublicKey, pubKey) {
+		return fmt.Errorf("%w: identity doesn't match the listen address", ErrInvalidHandshake)
+	}
+	return nil
+}
+
+func (n *Node) Ping(ctx context.Context, _ *proto.Ack) (*proto.Ack, error) {
+	return &proto.Ack{}, nil
+}
+
+// HandleTransaction accepts a transaction pushed by a client, or by a peer
+// not taking part in the inventory based gossip.
+func (n *Node) HandleTransaction(ctx context.Context, tx *proto.Transaction) (*proto.Ack, error) {
+	from, _ := n.callerID(ctx)
+	if err := n.processTransaction(tx, from); err != nil && !errors.Is(err, ErrTxKnown) {
+		return nil, err
+	}
 	return &proto.Ack{}, nil
 }
 
 func (n *Node) validatorLoop() {
-	n.logger.Infow("starting validator loop...", "pubKey", n.PrivateKey.PublicKey, "blocktime", blockTime)
+	n.logger.Infow("starting validator loop...", "pubKey", hex.EncodeToString(n.PrivateKey.Public().Bytes()), "blocktime", blockTime)
 	ticker := time.NewTicker(blockTime)
+	defer ticker.Stop()
 	for {
 		select {
+		case <-n.ctx.Done():
+			return
 		case <-ticker.C:
-			txs := n.mempool.Clear()
-			n.logger.Debug("time to create a new block", "lenTx", len(txs))
+			block, err := n.buildBlock()
+			if err != nil {
+				n.logger.Errorw("error building block", "err", err)
+				continue
+			}
+			if err := n.chain.AddBlock(block); err != nil {
+				n.logger.Errorw("error adding block", "err", err)
+				continue
+			}
+			n.logger.Debugw("created new block", "height", block.Header.Height, "lenTx", len(block.Transactions))
+			n.announce(&proto.InvItem{Type: proto.InvType_BLOCK, Hash: types.HashBlock(block)})
 		}
 	}
 }
 
-func (n *Node) broadcast(msg any) error {
-	n.peerLock.RLock()
-	defer n.peerLock.RUnlock()
+// buildBlock creates a signed block on top of the current tip, filled with
+// as many valid mempool transactions as the consensus limits allow.
+func (n *Node) buildBlock() (*proto.Block, error) {
+	tip, err := n.chain.GetBlockByHeight(n.chain.Height())
+	if err != nil {
+		return nil, err
+	}
+	// the roots, keys and signature are zero filled placeholders
+	// so the space they take is reserved when selecting transactions.
+	block := &proto.Block{
+		Header: &proto.Header{
+			Version:     blockVersion,
+			Height:      int32(n.chain.Height() + 1),
+			PrevHash:    types.HashBlock(tip),
+			RootHash:    make([]byte, 32),
+			WitnessRoot: make([]byte, 32),
+			FilterHash:  make([]byte, 32),
+			Timestamp:   time.Now().UnixNano(),
+			Proposer:    make([]byte, crypto.PubKeyLen),
+		},
+		PublicKey: make([]byte, crypto.PubKeyLen),
+		Signature: make([]byte, crypto.SignatureLen),
+	}
 
-	for p := range n.peers {
-		switch v := msg.(type) {
-		case *proto.Transaction:
-			_, err := p.HandleTransaction(context.Background(), v)
-			if err != nil {
-				return err
+	var (
+		params   = n.ConsensusParams
+		maxBytes = params.MaxBlockBytes - pb.Size(block)
+		txs      = n.mempool.Take(params.MaxBlockTxs, maxBytes)
+	)
+	spent := make(map[string]bool)
+	for _, tx := range txs {
+		err := n.chain.ValidateBlockTransaction(tx, spent)
+		if errors.Is(err, ErrUTXONotFound) {
+			// the parent may still be on its way, try again in a later block
+			if err := n.mempool.Add(tx); err != nil && !errors.Is(err, ErrTxKnown) {
+				n.logger.Debugw("dropping orphan transaction", "hash", hex.EncodeToString(types.HashTransaction(tx)), "err", err)
 			}
+			continue
 		}
+		if err != nil {
+			n.logger.Debugw("dropping invalid transaction", "hash", hex.EncodeToString(types.HashTransaction(tx)), "err", err)
+			continue
+		}
+		block.Transactions = append(block.Transactions, tx)
 	}
-	return nil
+
+	types.SignBlock(n.PrivateKey, block)
+	return block, nil
 }
 
-func (n *Node) bootstrapNetwork(addrs []string) error {
-	for _, addr := range addrs {
-		if !n.canConnectWith(addr) {
-			continue
-		}
-		n.logger.Debugw("dialing remote node",
-			"we", n.ListenAddr,
-			"remote node", addr)
-		c, v, err := n.dialRemoteNode(addr)
-		if err != nil {
-			return err
+// healthLoop periodically pings every peer so dead connections are
+// detected even when there is nothing to gossip.
+func (n *Node) healthLoop() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-ticker.C:
+			for _, p := range n.peers.List() {
+				p := p
+				n.spawn(func() { n.ping(p) })
+			}
 		}
-		n.addPeer(c, v)
 	}
+}
+
+func (n *Node) ping(p *Peer) {
+	ctx, cancel := context.WithTimeout(n.ctx, pingTimeout)
+	defer cancel()
+	if _, err := p.client.Ping(ctx, &proto.Ack{}); err != nil {
+		n.peerFailed(p, err)
+		return
+	}
+	n.peers.ReportSuccess(p.ID)
+}
+
+// peerFailed records a failed call to p and drops the peer once it is
+// deemed dead. Its address stays in the address book, so the discovery loop
+// redials it with a backoff.
+func (n *Node) peerFailed(p *Peer, err error) {
+	n.logger.Debugw("call to peer failed", "peer", p.ID, "err", err)
+	if n.peers.ReportFailure(p.ID) {
+		n.logger.Infow("peer removed", "peer", p.ID)
+	}
+}
+
+// connect dials addr and adds it as an outbound peer.
+func (n *Node) connect(addr string) error {
+	n.logger.Debugw("dialing remote node",
+		"we", n.ListenAddr,
+		"remote node", addr)
+	conn, c, v, err := n.dialRemoteNode(addr)
+	if err != nil {
+		n.addrBook.MarkAttempt(addr)
+		return err
+	}
+	n.addrBook.MarkGood(addr)
+	v.ListenAddr = resolveAddr(v.ListenAddr, hostOf(addr))
+	n.addPeer(NewPeer(conn, c, v, true))
 	return nil
 }
 
-func (n *Node) dialRemoteNode(addr string) (proto.NodeClient, *proto.Version, error) {
-	c, err := makeNodeClient(addr)
+func (n *Node) dialRemoteNode(addr string) (*grpc.ClientConn, proto.NodeClient, *proto.Version, error) {
+	conn, c, err := n.makeNodeClient(addr)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
-	v, err := c.Handshake(context.Background(), n.getVersion())
+	v, err := n.handshake(c)
 	if err != nil {
-		return nil, nil, err
+		conn.Close()
+		return nil, nil, nil, err
 	}
-	return c, v, nil
+	return conn, c, v, nil
 }
 
-func makeNodeClient(addr string) (proto.NodeClient, error) {
-	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+// handshake authenticates us to the remote node by answering its challenge
+// and challenges it back to authenticate its reply.
+func (n *Node) handshake(c proto.NodeClient) (*proto.Version, error) {
+	ctx := n.ctx
+	challenge, err := c.GetChallenge(ctx, &proto.Ack{})
+	if err != nil {
+		return nil, err
+	}
+	ourVersion := n.getVersion(challenge.Nonce)
+	ourVersion.Challenge = util.RandomHash()
+	types.SignVersion(n.IdentityKey, ourVersion)
+
+	var p peer.Peer
+	v, err := c.Handshake(ctx, ourVersion, grpc.Peer(&p))
 	if err != nil {
 		return nil, err
 	}
-	return proto.NewNodeClient(conn), nil
+	if err := n.checkVersion(v, ourVersion.Challenge); err != nil {
+		return nil, err
+	}
+	if err := n.TLS.checkPeerIdentity(&p, v.PublicKey); err != nil {
+		return nil, err
+	}
+	return v, nil
 }
 
-func (n *Node) addPeer(c proto.NodeClient, v *proto.Version) {
-	n.peerLock.Lock()
-	defer n.peerLock.Unlock()
+func (n *Node) makeNodeClient(addr string) (*grpc.ClientConn, proto.NodeClient, error) {
+	opt := grpc.WithInsecure()
+	if n.clientCreds != nil {
+		opt = grpc.WithTransportCredentials(n.clientCreds)
+	}
+	conn, err := grpc.Dial(addr, opt, grpc.WithStatsHandler(n.traffic))
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, proto.NewNodeClient(conn), nil
+}
 
+func (n *Node) addPeer(p *Peer) {
 	// TODO we need to decide if we accept or reject the peer
-	n.peers[c] = v
-
-	if len(v.PeerList) > 0 {
-		go n.bootstrapNetwork(v.PeerList)
+	if n.ctx.Err() != nil || !n.peers.Add(p) {
+		p.Close()
+		return
 	}
 
-	n.logger.Infow("peer added", "peer", v)
+	n.addAddrs(hostOf(p.version.ListenAddr), p.version.PeerList)
+
+	n.logger.Infow("peer added", "peer", p.ID, "version", p.version)
 }
 
-func (n *Node) deletePeer(c proto.NodeClient) {
-	n.peerLock.Lock()
-	defer n.peerLock.Unlock()
-	delete(n.peers, c)
+// getVersion returns our version signed with the identity key as an
+// answer to nonce.
+func (n *Node) getVersion(nonce []byte) *proto.Version {
+	v := &proto.Version{
+		Version:         n.Version,
+		Height:          0,
+		ListenAddr:      n.ListenAddr,
+		PeerList:        n.getPeerList(),
+		Nonce:           nonce,
+		ProtocolVersion: ProtocolVersion,
+		Services:        uint64(n.services()),
+	}
+	types.SignVersion(n.IdentityKey, v)
+	return v
 }
 
-func (n *Node) getVersion() *proto.Version {
-	return &proto.Version{
-		Version:    n.Version,
-		Height:     0,
-		ListenAddr: n.ListenAddr,
-		PeerList:   n.getPeerList(),
+// services returns the services we advertise to our peers.
+func (n *Node) services() Services {
+	s := n.Services | ServiceFullNode
+	if n.PrivateKey != nil {
+		s |= ServiceValidator
 	}
+	return s
 }
 
 func (n *Node) canConnectWith(addr string) bool {
@@ -266,12 +709,5 @@ func (n *Node) canConnectWith(addr string) bool {
 }
 
 func (n *Node) getPeerList() []string {
-	n.peerLock.RLock()
-	defer n.peerLock.RUnlock()
-
-	addrs := make([]string, 0, len(n.peers))
-	for _, v := range n.peers {
-		addrs = append(addrs, v.ListenAddr)
-	}
-	return addrs
+	return n.peers.Addrs()
 }
@@ -0,0 +1,166 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/types"
+	"github.com/vazj/blocker/util"
+)
+
+func randomTx() *proto.Transaction {
+	return &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{
+			{
+				PrevTxHash: util.RandomHash(),
+			},
+		},
+		Outputs: []*proto.TxOutput{
+			{
+				Amount:  1,
+				Address: util.RandomHash()[:crypto.AddressLen],
+			},
+		},
+	}
+}
+
+func TestMempoolAdd(t *testing.T) {
+	mempool := NewMempool(DefaultConsensusParams().MaxTxBytes)
+	tx := randomTx()
+	require.NoError(t, mempool.Add(tx))
+	assert.ErrorIs(t, mempool.Add(tx), ErrTxKnown)
+	assert.True(t, mempool.Has(tx))
+	assert.Equal(t, 1, mempool.Len())
+
+	largeTx := randomTx()
+	largeTx.Outputs[0].Address = make([]byte, DefaultConsensusParams().MaxTxBytes)
+	assert.ErrorIs(t, mempool.Add(largeTx), ErrTxTooLarge)
+	assert.Equal(t, 1, mempool.Len())
+}
+
+func TestMempoolConflicts(t *testing.T) {
+	var (
+		mempool = NewMempool(DefaultConsensusParams().MaxTxBytes)
+		a       = randomTx()
+		b       = randomTx()
+		c       = randomTx()
+	)
+	b.Inputs = a.Inputs
+	c.Inputs = a.Inputs
+	c.Outputs[0].Amount = 2
+	require.NoError(t, mempool.Add(a))
+	assert.ErrorIs(t, mempool.Add(b), ErrTxConflict)
+
+	// a block spending the same output evicts a and releases the output
+	mempool.Remove([]*proto.Transaction{c})
+	assert.Zero(t, mempool.Len())
+	require.NoError(t, mempool.Add(b))
+
+	// taken transactions release their outputs as well
+	require.Len(t, mempool.Take(1, 1<<20), 1)
+	require.NoError(t, mempool.Add(a))
+}
+
+func TestMempoolTake(t *testing.T) {
+	mempool := NewMempool(DefaultConsensusParams().MaxTxBytes)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, mempool.Add(randomTx()))
+	}
+
+	txs := mempool.Take(4, 1<<20)
+	assert.Len(t, txs, 4)
+	assert.Equal(t, 6, mempool.Len())
+
+	txSize := blockTxSize(randomTx())
+	txs = mempool.Take(10, 2*txSize)
+	assert.Len(t, txs, 2)
+	assert.Equal(t, 4, mempool.Len())
+}
+
+func TestBuildBlock(t *testing.T) {
+	var (
+		privKey = crypto.NewPrivateKeyFromSeedStr(godSeed)
+		node    = NewNode(ServerConfig{
+			PrivateKey: crypto.GeneratePrivateKey(),
+			ConsensusParams: ConsensusParams{
+				MaxBlockBytes: 1 << 20,
+				MaxBlockTxs:   1,
+				MaxTxBytes:    1 << 10,
+			},
+		})
+	)
+
+	genesis, err := node.chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{
+			{
+				PrevTxHash:   types.HashTransaction(genesis.Transactions[0]),
+				PrevOutIndex: 0,
+				PublicKey:    privKey.Public().Bytes(),
+			},
+		},
+		Outputs: []*proto.TxOutput{
+			{
+				Amount:  1000,
+				Address: privKey.Public().Address().Bytes(),
+			},
+		},
+	}
+	tx.Inputs[0].Signature = types.SignTransaction(privKey, tx).Bytes()
+	require.NoError(t, node.mempool.Add(tx))
+	// invalid and unsigned, has to be left out of the block
+	require.NoError(t, node.mempool.Add(randomTx()))
+
+	block, err := node.buildBlock()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(block.Transactions), 1)
+	require.NoError(t, node.chain.AddBlock(block))
+	assert.Equal(t, 1, node.chain.Height())
+	assert.Equal(t, 1, node.mempool.Len())
+}
+
+func TestBuildBlockConflictingTxs(t *testing.T) {
+	var (
+		privKey = crypto.NewPrivateKeyFromSeedStr(godSeed)
+		node    = NewNode(ServerConfig{PrivateKey: crypto.GeneratePrivateKey()})
+		address = privKey.Public().Address().Bytes()
+		a       = spendGenesis(t, node.chain, privKey, &proto.TxOutput{Amount: 1000, Address: address})
+		b       = spendGenesis(t, node.chain, privKey, &proto.TxOutput{Amount: 999, Address: address})
+	)
+	// child spends the output of a, which isn't in the chain yet
+	child := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash: types.HashTransaction(a),
+			PublicKey:  privKey.Public().Bytes(),
+		}},
+		Outputs: []*proto.TxOutput{{Amount: 1000, Address: address}},
+	}
+	child.Inputs[0].Signature = types.SignTransaction(privKey, child).Bytes()
+	require.NoError(t, node.mempool.Add(a))
+	assert.ErrorIs(t, node.mempool.Add(b), ErrTxConflict)
+	require.NoError(t, node.mempool.Add(child))
+
+	// the child is left for the block after the one of a
+	block, err := node.buildBlock()
+	require.NoError(t, err)
+	require.Len(t, block.Transactions, 1)
+	assert.Equal(t, types.HashTransaction(a), types.HashTransaction(block.Transactions[0]))
+	require.NoError(t, node.chain.AddBlock(block))
+	assert.Equal(t, 1, node.mempool.Len())
+	assert.True(t, node.mempool.Has(child))
+	// a confirmed transaction isn't admitted again
+	assert.ErrorIs(t, node.processTransaction(a, ""), ErrTxKnown)
+	assert.False(t, node.mempool.Has(a))
+
+	block, err = node.buildBlock()
+	require.NoError(t, err)
+	require.Len(t, block.Transactions, 1)
+	assert.Equal(t, types.HashTransaction(child), types.HashTransaction(block.Transactions[0]))
+}
@@ -0,0 +1,40 @@
+package node
+
+import (
+	"errors"
+
+	pb "github.com/golang/protobuf/proto"
+	"github.com/vazj/blocker/proto"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	ErrBlockTooLarge = errors.New("block exceeds the maximum block size")
+	ErrTooManyTxs    = errors.New("block exceeds the maximum number of transactions")
+	ErrTxTooLarge    = errors.New("transaction exceeds the maximum transaction size")
+)
+
+// ConsensusParams are the limits every node of the network has to agree on
+// for a block to be considered valid.
+type ConsensusParams struct {
+	// MaxBlockBytes is the maximum size of a protobuf encoded block.
+	MaxBlockBytes int
+	// MaxBlockTxs is the maximum number of transactions in a block.
+	MaxBlockTxs int
+	// MaxTxBytes is the maximum size of a protobuf encoded transaction.
+	MaxTxBytes int
+}
+
+func DefaultConsensusParams() ConsensusParams {
+	return ConsensusParams{
+		MaxBlockBytes: 1 << 20,
+		MaxBlockTxs:   4096,
+		MaxTxBytes:    100 << 10,
+	}
+}
+
+// blockTxSize returns how many bytes tx takes once embedded in a block,
+// which is its own size plus the field tag and length prefix.
+func blockTxSize(tx *proto.Transaction) int {
+	return protowire.SizeTag(2) + protowire.SizeBytes(pb.Size(tx))
+}
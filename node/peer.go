@@ -0,0 +1,278 @@
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/vazj/blocker/proto"
+	"google.golang.org/grpc"
+)
+
+const (
+	// pingInterval is how often connected peers are health checked.
+	pingInterval = 10 * time.Second
+	pingTimeout  = 3 * time.Second
+	// maxPeerFailures is the number of consecutive failed calls after
+	// which a peer is considered dead and gets disconnected.
+	maxPeerFailures = 3
+
+	defaultMinOutboundPeers = 4
+	defaultMaxOutboundPeers = 8
+	defaultMaxInboundPeers  = 32
+)
+
+var ErrTooManyPeers = errors.New("too many peers")
+
+// Peer is a remote node we hold an open connection with.
+type Peer struct {
+	// ID is stable across reconnections of the same remote node.
+	ID       string
+	conn     *grpc.ClientConn
+	client   proto.NodeClient
+	version  *proto.Version
+	failures int
+	// outbound is set when we dialed the peer, as opposed to the peer
+	// connecting to us.
+	outbound bool
+	// known holds the inventory items the peer is known to have.
+	known *invSet
+}
+
+func NewPeer(conn *grpc.ClientConn, client proto.NodeClient, v *proto.Version, outbound bool) *Peer {
+	return &Peer{
+		ID:       peerID(v),
+		conn:     conn,
+		client:   client,
+		version:  v,
+		outbound: outbound,
+		known:    newInvSet(maxKnownInv),
+	}
+}
+
+// peerID identifies a peer by its identity public key.
+func peerID(v *proto.Version) string {
+	return hex.EncodeToString(v.PublicKey)
+}
+
+// Supports reports whether the peer speaks at least the given protocol
+// version, and so has the RPCs it introduced.
+func (p *Peer) Supports(protocolVersion uint32) bool {
+	return p.version.ProtocolVersion >= protocolVersion
+}
+
+// Services returns the services the peer advertised in its handshake.
+func (p *Peer) Services() Services {
+	return Services(p.version.Services)
+}
+
+func (p *Peer) Close() error {
+	if p.conn == nil {
+		return nil
+	}
+	return p.conn.Close()
+}
+
+type PeerManager struct {
+	lock  sync.RWMutex
+	peers map[string]*Peer
+	// scores are the misbehaviour scores by peer ID.
+	scores map[string]int
+	// conns maps the remote address of the connections peers authenticated
+	// over to their ID, so incoming calls can be attributed to a peer.
+	conns map[string]string
+}
+
+func NewPeerManager() *PeerManager {
+	return &PeerManager{
+		peers:  make(map[string]*Peer),
+		scores: make(map[string]int),
+		conns:  make(map[string]string),
+	}
+}
+
+// Add registers p and returns false if a peer with the same ID is already
+// registered, in which case p is left untouched.
+func (pm *PeerManager) Add(p *Peer) bool {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	if _, ok := pm.peers[p.ID]; ok {
+		return false
+	}
+	pm.peers[p.ID] = p
+	return true
+}
+
+func (pm *PeerManager) Get(id string) (*Peer, bool) {
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
+	p, ok := pm.peers[id]
+	return p, ok
+}
+
+// Clear unregisters every peer and closes their connections.
+func (pm *PeerManager) Clear() {
+	pm.lock.Lock()
+	peers := pm.peers
+	pm.peers = make(map[string]*Peer)
+	pm.conns = make(map[string]string)
+	pm.lock.Unlock()
+	for _, p := range peers {
+		p.Close()
+	}
+}
+
+// Remove unregisters the peer and closes its connection.
+func (pm *PeerManager) Remove(id string) (*Peer, bool) {
+	pm.lock.Lock()
+	p, ok := pm.peers[id]
+	pm.remove(id)
+	pm.lock.Unlock()
+	if ok {
+		p.Close()
+	}
+	return p, ok
+}
+
+// remove forgets everything about the peer but its score, which has to
+// survive reconnections. The lock must be held.
+func (pm *PeerManager) remove(id string) {
+	delete(pm.peers, id)
+	for addr, connID := range pm.conns {
+		if connID == id {
+			delete(pm.conns, addr)
+		}
+	}
+}
+
+// BindConn records that the connection coming from remoteAddr was
+// authenticated as the peer with the given ID.
+func (pm *PeerManager) BindConn(remoteAddr, id string) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	pm.conns[remoteAddr] = id
+}
+
+// ConnPeerID returns the ID of the peer the connection coming from
+// remoteAddr was authenticated as.
+func (pm *PeerManager) ConnPeerID(remoteAddr string) (string, bool) {
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
+	id, ok := pm.conns[remoteAddr]
+	return id, ok
+}
+
+// AddScore increases the misbehaviour score of a peer and returns the new
+// score.
+func (pm *PeerManager) AddScore(id string, penalty int) int {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	pm.scores[id] += penalty
+	return pm.scores[id]
+}
+
+func (pm *PeerManager) Score(id string) int {
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
+	return pm.scores[id]
+}
+
+func (pm *PeerManager) ResetScore(id string) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	delete(pm.scores, id)
+}
+
+// ReportFailure records a failed call to the peer. Once the peer reaches
+// maxPeerFailures consecutive failures it is removed and true is returned.
+func (pm *PeerManager) ReportFailure(id string) bool {
+	pm.lock.Lock()
+	p, ok := pm.peers[id]
+	if !ok {
+		pm.lock.Unlock()
+		return false
+	}
+	p.failures++
+	if p.failures < maxPeerFailures {
+		pm.lock.Unlock()
+		return false
+	}
+	pm.remove(id)
+	pm.lock.Unlock()
+	p.Close()
+	return true
+}
+
+func (pm *PeerManager) ReportSuccess(id string) {
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+	if p, ok := pm.peers[id]; ok {
+		p.failures = 0
+	}
+}
+
+// List returns a snapshot of the connected peers, so callers can talk to
+// them without holding the lock.
+func (pm *PeerManager) List() []*Peer {
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
+	peers := make([]*Peer, 0, len(pm.peers))
+	for _, p := range pm.peers {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+func (pm *PeerManager) Len() int {
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
+	return len(pm.peers)
+}
+
+// Outbound returns the number of peers we dialed.
+func (pm *PeerManager) Outbound() int {
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
+	return pm.countOutbound()
+}
+
+// Inbound returns the number of peers that dialed us.
+func (pm *PeerManager) Inbound() int {
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
+	return len(pm.peers) - pm.countOutbound()
+}
+
+func (pm *PeerManager) countOutbound() int {
+	count := 0
+	for _, p := range pm.peers {
+		if p.outbound {
+			count++
+		}
+	}
+	return count
+}
+
+func (pm *PeerManager) Addrs() []string {
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
+	addrs := make([]string, 0, len(pm.peers))
+	for _, p := range pm.peers {
+		addrs = append(addrs, p.version.ListenAddr)
+	}
+	return addrs
+}
+
+// OutboundAddrs returns the listen addresses of the peers we dialed.
+func (pm *PeerManager) OutboundAddrs() []string {
+	pm.lock.RLock()
+	defer pm.lock.RUnlock()
+	addrs := make([]string, 0, len(pm.peers))
+	for _, p := range pm.peers {
+		if p.outbound {
+			addrs = append(addrs, p.version.ListenAddr)
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,186 @@
+package node
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/util"
+	"google.golang.org/grpc"
+)
+
+// fakeNodeClient records the transactions and announcements it receives
+// and fails every call when err is set.
+type fakeNodeClient struct {
+	proto.NodeClient
+
+	lock sync.Mutex
+	txx  []*proto.Transaction
+	invs []*proto.Inv
+	err  error
+}
+
+func (c *fakeNodeClient) HandleTransaction(ctx context.Context, tx *proto.Transaction, opts ...grpc.CallOption) (*proto.Ack, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.txx = append(c.txx, tx)
+	return &proto.Ack{}, nil
+}
+
+func (c *fakeNodeClient) HandleInv(ctx context.Context, inv *proto.Inv, opts ...grpc.CallOption) (*proto.Ack, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.invs = append(c.invs, inv)
+	return &proto.Ack{}, nil
+}
+
+func (c *fakeNodeClient) Ping(ctx context.Context, in *proto.Ack, opts ...grpc.CallOption) (*proto.Ack, error) {
+	return &proto.Ack{}, c.err
+}
+
+func newFakePeer(addr string, err error) (*Peer, *fakeNodeClient) {
+	c := &fakeNodeClient{err: err}
+	v := &proto.Version{
+		ListenAddr:      addr,
+		PublicKey:       crypto.GeneratePrivateKey().Public().Bytes(),
+		ProtocolVersion: ProtocolVersion,
+	}
+	return NewPeer(nil, c, v, true), c
+}
+
+func randomInv() *proto.Inv {
+	return &proto.Inv{
+		Items: []*proto.InvItem{{Type: proto.InvType_TX, Hash: util.RandomHash()}},
+	}
+}
+
+func nodeID(n *Node) string {
+	return hex.EncodeToString(n.IdentityKey.Public().Bytes())
+}
+
+// freeAddr returns a local address nobody is listening on.
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// startNode starts a node on a free local address and waits for it to
+// accept connections.
+func startNode(t *testing.T, cfg ServerConfig, bootstrapNodes ...string) (*Node, string) {
+	addr := freeAddr(t)
+	n := NewNode(cfg)
+	go n.Start(addr, bootstrapNodes)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		n.Stop(ctx)
+	})
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, time.Second, 10*time.Millisecond)
+	return n, addr
+}
+
+func connected(a, b *Node) bool {
+	_, okA := a.peers.Get(nodeID(b))
+	_, okB := b.peers.Get(nodeID(a))
+	return okA && okB
+}
+
+func TestPeerManagerAdd(t *testing.T) {
+	pm := NewPeerManager()
+	p, _ := newFakePeer(":3000", nil)
+	assert.True(t, pm.Add(p))
+	dup := NewPeer(nil, nil, p.version, true)
+	assert.False(t, pm.Add(dup))
+	assert.Equal(t, 1, pm.Len())
+
+	got, ok := pm.Get(p.ID)
+	require.True(t, ok)
+	assert.Same(t, p, got)
+	assert.Equal(t, []string{":3000"}, pm.Addrs())
+
+	_, ok = pm.Remove(p.ID)
+	assert.True(t, ok)
+	assert.Equal(t, 0, pm.Len())
+}
+
+func TestPeerManagerReportFailure(t *testing.T) {
+	pm := NewPeerManager()
+	p, _ := newFakePeer(":3000", nil)
+	pm.Add(p)
+
+	for i := 0; i < maxPeerFailures-1; i++ {
+		assert.False(t, pm.ReportFailure(p.ID))
+	}
+	pm.ReportSuccess(p.ID)
+	for i := 0; i < maxPeerFailures-1; i++ {
+		assert.False(t, pm.ReportFailure(p.ID))
+	}
+	assert.True(t, pm.ReportFailure(p.ID))
+	assert.Equal(t, 0, pm.Len())
+	assert.False(t, pm.ReportFailure(p.ID))
+}
+
+func TestBroadcastSkipsFailingPeers(t *testing.T) {
+	node := NewNode(ServerConfig{ListenAddr: ":3000"})
+	p1, alive1 := newFakePeer(":4000", nil)
+	deadPeer, _ := newFakePeer(":5000", errors.New("connection refused"))
+	p2, alive2 := newFakePeer(":6000", nil)
+	for _, p := range []*Peer{p1, deadPeer, p2} {
+		require.True(t, node.peers.Add(p))
+	}
+
+	for i := 0; i < maxPeerFailures; i++ {
+		assert.Error(t, node.broadcast(randomInv()))
+	}
+	assert.Len(t, alive1.invs, maxPeerFailures)
+	assert.Len(t, alive2.invs, maxPeerFailures)
+
+	_, ok := node.peers.Get(deadPeer.ID)
+	assert.False(t, ok)
+	assert.NoError(t, node.broadcast(randomInv()))
+}
+
+func TestNodesConnect(t *testing.T) {
+	var (
+		addrA = freeAddr(t)
+		addrB = freeAddr(t)
+		nodeA = NewNode(ServerConfig{})
+		nodeB = NewNode(ServerConfig{})
+	)
+	go nodeA.Start(addrA, []string{})
+	time.Sleep(100 * time.Millisecond)
+	go nodeB.Start(addrB, []string{addrA})
+
+	require.Eventually(t, func() bool {
+		_, okA := nodeA.peers.Get(nodeID(nodeB))
+		_, okB := nodeB.peers.Get(nodeID(nodeA))
+		return okA && okB
+	}, 2*time.Second, 10*time.Millisecond)
+
+	p, _ := nodeB.peers.Get(nodeID(nodeA))
+	nodeB.ping(p)
+	assert.Equal(t, 0, p.failures)
+}
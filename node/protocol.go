@@ -0,0 +1,69 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Versions of the peer to peer protocol. Every version adds RPCs on top of
+// the previous ones, which are only called on peers advertising a protocol
+// version that has them.
+const (
+	// protocolHandshake is the base protocol: authenticated handshakes,
+	// pings and transactions pushed with HandleTransaction.
+	protocolHandshake uint32 = 1
+	// protocolPeerExchange adds GetPeers.
+	protocolPeerExchange uint32 = 2
+	// protocolInvGossip adds HandleInv and GetData.
+	protocolInvGossip uint32 = 3
+
+	// ProtocolVersion is the protocol version this node speaks.
+	ProtocolVersion = protocolInvGossip
+	// MinProtocolVersion is the oldest protocol version we peer with.
+	MinProtocolVersion = protocolHandshake
+)
+
+var ErrIncompatibleVersion = errors.New("incompatible protocol version")
+
+// Services is the bitset of services a node offers to its peers.
+type Services uint64
+
+const (
+	// ServiceFullNode nodes validate and relay blocks and transactions.
+	ServiceFullNode Services = 1 << iota
+	// ServiceArchive nodes keep every block since genesis.
+	ServiceArchive
+	// ServiceValidator nodes propose blocks.
+	ServiceValidator
+	// ServiceLightClient nodes serve proofs and filters to light clients.
+	ServiceLightClient
+)
+
+var serviceNames = []string{"full", "archive", "validator", "light"}
+
+// Has reports whether every service in s2 is set in s.
+func (s Services) Has(s2 Services) bool {
+	return s&s2 == s2
+}
+
+func (s Services) String() string {
+	names := make([]string, 0, len(serviceNames))
+	for i, name := range serviceNames {
+		if s.Has(1 << i) {
+			names = append(names, name)
+		}
+	}
+	if unknown := s >> len(serviceNames); unknown != 0 {
+		names = append(names, fmt.Sprintf("unknown(%#x)", uint64(unknown<<len(serviceNames))))
+	}
+	return strings.Join(names, "|")
+}
+
+// checkProtocolVersion rejects peers speaking a protocol too old for us.
+func checkProtocolVersion(version uint32) error {
+	if version < MinProtocolVersion {
+		return fmt.Errorf("%w: got %d, min %d", ErrIncompatibleVersion, version, MinProtocolVersion)
+	}
+	return nil
+}
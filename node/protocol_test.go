@@ -0,0 +1,81 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/types"
+)
+
+func TestServices(t *testing.T) {
+	s := ServiceFullNode | ServiceValidator
+	assert.True(t, s.Has(ServiceFullNode))
+	assert.True(t, s.Has(ServiceFullNode|ServiceValidator))
+	assert.False(t, s.Has(ServiceFullNode|ServiceArchive))
+	assert.Equal(t, "full|validator", s.String())
+	assert.Equal(t, "light|unknown(0x30)", (ServiceLightClient | 0x30).String())
+}
+
+func TestHandshakeNegotiatesServices(t *testing.T) {
+	nodeA, addrA := startNode(t, ServerConfig{
+		PrivateKey: crypto.GeneratePrivateKey(),
+		Services:   ServiceArchive,
+	})
+	nodeB, _ := startNode(t, ServerConfig{}, addrA)
+	require.Eventually(t, func() bool {
+		return connected(nodeA, nodeB)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	p, ok := nodeB.peers.Get(nodeID(nodeA))
+	require.True(t, ok)
+	assert.True(t, p.Supports(ProtocolVersion))
+	assert.Equal(t, ServiceFullNode|ServiceArchive|ServiceValidator, p.Services())
+
+	p, ok = nodeA.peers.Get(nodeID(nodeB))
+	require.True(t, ok)
+	assert.Equal(t, ServiceFullNode, p.Services())
+}
+
+func TestBroadcastToLegacyPeer(t *testing.T) {
+	var (
+		node       = NewNode(ServerConfig{})
+		legacy, lc = newFakePeer(":4000", nil)
+		current, c = newFakePeer(":5000", nil)
+		tx         = signedTx(1)
+	)
+	legacy.version.ProtocolVersion = protocolPeerExchange
+	node.peers.Add(legacy)
+	node.peers.Add(current)
+	require.NoError(t, node.mempool.Add(tx))
+
+	inv := &proto.Inv{Items: []*proto.InvItem{
+		{Type: proto.InvType_TX, Hash: types.HashTransaction(tx)},
+		{Type: proto.InvType_BLOCK, Hash: types.HashBlock(randomBlock(t, node.chain))},
+	}}
+	require.NoError(t, node.broadcast(inv))
+
+	// peers too old for inventory gossip get the transaction pushed
+	assert.Empty(t, lc.invs)
+	require.Len(t, lc.txx, 1)
+	assert.Equal(t, types.HashTransaction(tx), types.HashTransaction(lc.txx[0]))
+	assert.Empty(t, c.txx)
+	require.Len(t, c.invs, 1)
+	assert.Len(t, c.invs[0].Items, 2)
+
+	// it's never called with HandleInv, which it doesn't have
+	_, err := node.HandleTransaction(context.Background(), signedTx(1))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		lc.lock.Lock()
+		defer lc.lock.Unlock()
+		return len(lc.txx) == 2
+	}, time.Second, 10*time.Millisecond)
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+	assert.Empty(t, lc.invs)
+}
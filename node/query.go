@@ -0,0 +1,202 @@
+package node
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/types"
+)
+
+const (
+	// maxMempoolQuery caps the number of transactions GetMempool returns.
+	maxMempoolQuery = 1000
+	// defaultPageSize is the number of items of an address returned when
+	// the request has no limit, maxPageSize caps the requested limit.
+	defaultPageSize = 100
+	maxPageSize     = 1000
+	// defaultHeadersBatch is the number of headers returned when the
+	// request has no limit, maxHeadersBatch caps the requested limit.
+	defaultHeadersBatch = 500
+	maxHeadersBatch     = 2000
+	// the same for the filters, which are larger than the headers
+	defaultFiltersBatch = 100
+	maxFiltersBatch     = 1000
+)
+
+// QueryServer serves read-only lookups of the chain state to wallets and
+// explorers.
+type QueryServer struct {
+	node *Node
+
+	proto.UnimplementedQueryServer
+}
+
+func NewQueryServer(n *Node) *QueryServer {
+	return &QueryServer{node: n}
+}
+
+func (s *QueryServer) GetBlockByHeight(ctx context.Context, req *proto.HeightRequest) (*proto.Block, error) {
+	return s.node.chain.GetBlockByHeight(int(req.Height))
+}
+
+func (s *QueryServer) GetBlockByHash(ctx context.Context, req *proto.HashRequest) (*proto.Block, error) {
+	return s.node.chain.GetBlockByHash(req.Hash)
+}
+
+// GetTransaction looks a transaction up in the chain, then in the mempool.
+func (s *QueryServer) GetTransaction(ctx context.Context, req *proto.HashRequest) (*proto.TransactionInfo, error) {
+	if info, err := s.node.chain.GetTransactionInfo(req.Hash); err == nil {
+		return info, nil
+	}
+	hash := hex.EncodeToString(req.Hash)
+	if tx, ok := s.node.mempool.Get(hash); ok {
+		return &proto.TransactionInfo{Transaction: tx, Pending: true}, nil
+	}
+	return nil, fmt.Errorf("tx with hash[%s] doesn't exist", hash)
+}
+
+// GetUTXOs returns a page of the unspent outputs paying to the requested
+// address.
+func (s *QueryServer) GetUTXOs(ctx context.Context, req *proto.AddressRequest) (*proto.UTXOList, error) {
+	offset, limit, err := pageOf(req)
+	if err != nil {
+		return nil, err
+	}
+	utxos, total, err := s.node.chain.GetUTXOs(req.Address, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	list := &proto.UTXOList{Total: uint32(total)}
+	for _, utxo := range utxos {
+		hash, err := hex.DecodeString(utxo.Hash)
+		if err != nil {
+			return nil, err
+		}
+		list.Utxos = append(list.Utxos, &proto.UTXO{
+			TxHash:   hash,
+			OutIndex: uint32(utxo.OutIndex),
+			Amount:   utxo.Amount,
+			Address:  utxo.Address,
+		})
+	}
+	return list, nil
+}
+
+// GetBalance returns the sum of the unspent outputs paying to the
+// requested address.
+func (s *QueryServer) GetBalance(ctx context.Context, req *proto.AddressRequest) (*proto.Balance, error) {
+	if err := checkAddress(req.Address); err != nil {
+		return nil, err
+	}
+	amount, err := s.node.chain.GetBalance(req.Address)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.Balance{Address: req.Address, Amount: amount}, nil
+}
+
+// GetAddressTxs returns a page of the transactions touching the requested
+// address, oldest first.
+func (s *QueryServer) GetAddressTxs(ctx context.Context, req *proto.AddressRequest) (*proto.AddressTxs, error) {
+	offset, limit, err := pageOf(req)
+	if err != nil {
+		return nil, err
+	}
+	txs, total, err := s.node.chain.GetAddressTxs(req.Address, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.AddressTxs{Transactions: txs, Total: uint32(total)}, nil
+}
+
+// GetMerkleProof returns the proof that the requested transaction is
+// included in its block.
+func (s *QueryServer) GetMerkleProof(ctx context.Context, req *proto.HashRequest) (*proto.MerkleProof, error) {
+	info, err := s.node.chain.GetTransactionInfo(req.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return info.Proof, nil
+}
+
+// GetHeaders returns a batch of signed headers for clients syncing the
+// chain without the transactions.
+func (s *QueryServer) GetHeaders(ctx context.Context, req *proto.HeadersRequest) (*proto.SignedHeaders, error) {
+	limit := batchSize(req.Limit, defaultHeadersBatch, maxHeadersBatch)
+	headers, err := s.node.chain.GetSignedHeaders(int(req.FromHeight), limit)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.SignedHeaders{Headers: headers}, nil
+}
+
+// GetFilterHeaders returns a batch of filter headers, which clients use to
+// check the filters they are served.
+func (s *QueryServer) GetFilterHeaders(ctx context.Context, req *proto.FilterRequest) (*proto.FilterHeaders, error) {
+	limit := batchSize(req.Limit, defaultHeadersBatch, maxHeadersBatch)
+	headers, prevHeader, err := s.node.chain.GetFilterHeaders(int(req.FromHeight), limit)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.FilterHeaders{Headers: headers, PrevHeader: prevHeader}, nil
+}
+
+// GetFilters returns a batch of block filters.
+func (s *QueryServer) GetFilters(ctx context.Context, req *proto.FilterRequest) (*proto.BlockFilters, error) {
+	limit := batchSize(req.Limit, defaultFiltersBatch, maxFiltersBatch)
+	filters, err := s.node.chain.GetBlockFilters(int(req.FromHeight), limit)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.BlockFilters{Filters: filters}, nil
+}
+
+// batchSize returns the number of items to return for the requested limit.
+func batchSize(limit uint32, def, maxLimit int) int {
+	switch {
+	case limit == 0:
+		return def
+	case int(limit) > maxLimit:
+		return maxLimit
+	}
+	return int(limit)
+}
+
+func checkAddress(address []byte) error {
+	if len(address) != crypto.AddressLen {
+		return fmt.Errorf("invalid address length %d", len(address))
+	}
+	return nil
+}
+
+// pageOf validates the address of req and returns the page it asks for.
+func pageOf(req *proto.AddressRequest) (int, int, error) {
+	if err := checkAddress(req.Address); err != nil {
+		return 0, 0, err
+	}
+	return int(req.Offset), batchSize(req.Limit, defaultPageSize, maxPageSize), nil
+}
+
+func (s *QueryServer) GetChainInfo(ctx context.Context, _ *proto.Ack) (*proto.ChainInfo, error) {
+	tip, err := s.node.chain.Tip()
+	if err != nil {
+		return nil, err
+	}
+	return &proto.ChainInfo{
+		Height:       tip.Header.Height,
+		TipHash:      types.HashBlock(tip),
+		TipTimestamp: tip.Header.Timestamp,
+		GenesisHash:  types.HashBlock(s.node.Genesis),
+		MempoolSize:  int32(s.node.mempool.Len()),
+	}, nil
+}
+
+func (s *QueryServer) GetMempool(ctx context.Context, _ *proto.Ack) (*proto.MempoolInfo, error) {
+	return &proto.MempoolInfo{
+		Size:         int32(s.node.mempool.Len()),
+		Transactions: s.node.mempool.List(maxMempoolQuery),
+	}, nil
+}
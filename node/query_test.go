@@ -0,0 +1,144 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/types"
+	"github.com/vazj/blocker/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestQueryBlocksAndChainInfo(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		node  = NewNode(ServerConfig{PrivateKey: crypto.GeneratePrivateKey()})
+		query = NewQueryServer(node)
+	)
+	block, err := node.buildBlock()
+	require.NoError(t, err)
+	require.NoError(t, node.chain.AddBlock(block))
+	hash := types.HashBlock(block)
+
+	b, err := query.GetBlockByHeight(ctx, &proto.HeightRequest{Height: 1})
+	require.NoError(t, err)
+	assert.Equal(t, hash, types.HashBlock(b))
+	b, err = query.GetBlockByHash(ctx, &proto.HashRequest{Hash: hash})
+	require.NoError(t, err)
+	assert.Equal(t, block.Header.Height, b.Header.Height)
+
+	_, err = query.GetBlockByHeight(ctx, &proto.HeightRequest{Height: 2})
+	assert.Error(t, err)
+	_, err = query.GetBlockByHeight(ctx, &proto.HeightRequest{Height: -1})
+	assert.Error(t, err)
+	_, err = query.GetBlockByHash(ctx, &proto.HashRequest{Hash: util.RandomHash()})
+	assert.Error(t, err)
+
+	headers, err := query.GetHeaders(ctx, &proto.HeadersRequest{FromHeight: 1})
+	require.NoError(t, err)
+	require.Len(t, headers.Headers, 1)
+	assert.Equal(t, hash, types.HashHeader(headers.Headers[0].Header))
+	assert.True(t, types.VerifySignedHeader(headers.Headers[0]))
+	headers, err = query.GetHeaders(ctx, &proto.HeadersRequest{FromHeight: 0, Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, headers.Headers, 1)
+
+	filters, err := query.GetFilters(ctx, &proto.FilterRequest{FromHeight: 1})
+	require.NoError(t, err)
+	require.Len(t, filters.Filters, 1)
+	assert.Equal(t, hash, filters.Filters[0].BlockHash)
+	filterHeaders, err := query.GetFilterHeaders(ctx, &proto.FilterRequest{FromHeight: 1})
+	require.NoError(t, err)
+	require.Len(t, filterHeaders.Headers, 1)
+	assert.Equal(t, types.FilterHeader(filters.Filters[0].Filter, filterHeaders.PrevHeader), filterHeaders.Headers[0])
+
+	require.NoError(t, node.mempool.Add(signedTx(1)))
+	info, err := query.GetChainInfo(ctx, &proto.Ack{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), info.Height)
+	assert.Equal(t, hash, info.TipHash)
+	assert.Equal(t, block.Header.Timestamp, info.TipTimestamp)
+	assert.Equal(t, types.HashBlock(createGenesisBlock()), info.GenesisHash)
+	assert.Equal(t, int32(1), info.MempoolSize)
+}
+
+func TestQueryTransactionsAndBalances(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		node    = NewNode(ServerConfig{})
+		query   = NewQueryServer(node)
+		genesis = createGenesisBlock()
+		address = crypto.NewPrivateKeyFromSeedStr(godSeed).Public().Address().Bytes()
+		pending = signedTx(1)
+	)
+	require.NoError(t, node.mempool.Add(pending))
+
+	genesisTx := genesis.Transactions[0]
+	info, err := query.GetTransaction(ctx, &proto.HashRequest{Hash: types.HashTransaction(genesisTx)})
+	require.NoError(t, err)
+	assert.False(t, info.Pending)
+	assert.Equal(t, int32(1), info.Confirmations)
+	assert.Equal(t, types.HashBlock(genesis), info.BlockHash)
+	proof, err := query.GetMerkleProof(ctx, &proto.HashRequest{Hash: types.HashTransaction(genesisTx)})
+	require.NoError(t, err)
+	assert.True(t, types.VerifyTxInclusion(genesis.Header, genesisTx, proof))
+	assert.Equal(t, types.HashTransaction(genesisTx), types.HashTransaction(info.Transaction))
+
+	info, err = query.GetTransaction(ctx, &proto.HashRequest{Hash: types.HashTransaction(pending)})
+	require.NoError(t, err)
+	assert.True(t, info.Pending)
+
+	_, err = query.GetTransaction(ctx, &proto.HashRequest{Hash: util.RandomHash()})
+	assert.Error(t, err)
+
+	utxos, err := query.GetUTXOs(ctx, &proto.AddressRequest{Address: address})
+	require.NoError(t, err)
+	require.Len(t, utxos.Utxos, 1)
+	assert.Equal(t, types.HashTransaction(genesisTx), utxos.Utxos[0].TxHash)
+	assert.Equal(t, uint32(0), utxos.Utxos[0].OutIndex)
+	assert.Equal(t, uint32(1), utxos.Total)
+	utxos, err = query.GetUTXOs(ctx, &proto.AddressRequest{Address: address, Offset: 1})
+	require.NoError(t, err)
+	assert.Empty(t, utxos.Utxos)
+	assert.Equal(t, uint32(1), utxos.Total)
+
+	txs, err := query.GetAddressTxs(ctx, &proto.AddressRequest{Address: address})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), txs.Total)
+	require.Len(t, txs.Transactions, 1)
+	assert.Equal(t, types.HashTransaction(genesisTx), types.HashTransaction(txs.Transactions[0]))
+	_, err = query.GetAddressTxs(ctx, &proto.AddressRequest{Address: []byte{1, 2}})
+	assert.Error(t, err)
+
+	balance, err := query.GetBalance(ctx, &proto.AddressRequest{Address: address})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), balance.Amount)
+	_, err = query.GetBalance(ctx, &proto.AddressRequest{Address: []byte{1, 2}})
+	assert.Error(t, err)
+
+	mempool, err := query.GetMempool(ctx, &proto.Ack{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), mempool.Size)
+	require.Len(t, mempool.Transactions, 1)
+	assert.Equal(t, types.HashTransaction(pending), types.HashTransaction(mempool.Transactions[0]))
+}
+
+func TestQueryService(t *testing.T) {
+	_, addr := startNode(t, ServerConfig{})
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	info, err := proto.NewQueryClient(conn).GetChainInfo(ctx, &proto.Ack{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), info.Height)
+	assert.Equal(t, info.GenesisHash, info.TipHash)
+}
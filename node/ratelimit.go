@@ -0,0 +1,232 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	pb "github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	// maxLimiterBuckets is the number of callers a limiter tracks before it
+	// starts dropping the ones that have been idle long enough to be back
+	// to a full bucket.
+	maxLimiterBuckets = 10000
+
+	penaltyRateLimit = 5
+)
+
+var (
+	ErrRateLimited     = errors.New("rate limit exceeded")
+	ErrMessageTooLarge = errors.New("message exceeds the maximum size")
+)
+
+// RateLimit is a token bucket refilled with Rate tokens per second that
+// holds at most Burst tokens. A zero Rate disables the limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// MethodLimit limits the calls to a single RPC method, per caller.
+type MethodLimit struct {
+	RateLimit
+	// MaxMsgBytes is the maximum size of a request to the method, zero
+	// means only the server wide MaxRecvMsgBytes applies.
+	MaxMsgBytes int
+}
+
+// RateLimits protect the node service from callers hammering it. Limits are
+// applied per caller, which is the identity of authenticated peers and the
+// remote IP of everyone else. Zero fields get their default value.
+type RateLimits struct {
+	// Peer limits the calls of a caller across every method.
+	Peer RateLimit
+	// Methods limit the calls to single methods, keyed by full method name
+	// such as "/Node/HandleTransaction".
+	Methods map[string]MethodLimit
+	// MaxConcurrentStreams is the number of concurrent calls a single
+	// connection can make.
+	MaxConcurrentStreams uint32
+	// MaxRecvMsgBytes is the maximum size of any request to the node.
+	MaxRecvMsgBytes int
+}
+
+func DefaultRateLimits(params ConsensusParams) RateLimits {
+	return RateLimits{
+		Peer: RateLimit{Rate: 200, Burst: 400},
+		Methods: map[string]MethodLimit{
+			"/Node/GetChallenge":      {RateLimit: RateLimit{Rate: 20, Burst: 100}},
+			"/Node/Handshake":         {RateLimit: RateLimit{Rate: 10, Burst: 50}, MaxMsgBytes: 64 << 10},
+			"/Node/Identify":          {RateLimit: RateLimit{Rate: 10, Burst: 50}, MaxMsgBytes: 64 << 10},
+			"/Node/GetPeers":          {RateLimit: RateLimit{Rate: 1, Burst: 10}},
+			"/Node/HandleTransaction": {RateLimit: RateLimit{Rate: 100, Burst: 200}, MaxMsgBytes: params.MaxTxBytes},
+			"/Node/HandleInv":         {RateLimit: RateLimit{Rate: 100, Burst: 200}, MaxMsgBytes: 64 << 10},
+			"/Node/GetData":           {RateLimit: RateLimit{Rate: 100, Burst: 200}, MaxMsgBytes: 64 << 10},
+		},
+		MaxConcurrentStreams: 100,
+		MaxRecvMsgBytes:      params.MaxBlockBytes,
+	}
+}
+
+// withDefaults fills the zero fields of l with the defaults.
+func (l RateLimits) withDefaults(params ConsensusParams) RateLimits {
+	defaults := DefaultRateLimits(params)
+	if l.Peer == (RateLimit{}) {
+		l.Peer = defaults.Peer
+	}
+	if l.Methods == nil {
+		l.Methods = defaults.Methods
+	}
+	if l.MaxConcurrentStreams == 0 {
+		l.MaxConcurrentStreams = defaults.MaxConcurrentStreams
+	}
+	if l.MaxRecvMsgBytes == 0 {
+		l.MaxRecvMsgBytes = defaults.MaxRecvMsgBytes
+	}
+	return l
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket per key.
+type rateLimiter struct {
+	lock    sync.Mutex
+	limit   RateLimit
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	return &rateLimiter{
+		limit:   limit,
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of key, if there is one left.
+func (l *rateLimiter) Allow(key string) bool {
+	if l.limit.Rate <= 0 {
+		return true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxLimiterBuckets {
+			l.prune(now)
+		}
+		b = &tokenBucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.limit.Rate
+	if max := float64(l.limit.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune drops the buckets that would be full by now, which behave the same
+// as a missing bucket.
+func (l *rateLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// requestLimiter enforces RateLimits on the incoming calls.
+type requestLimiter struct {
+	peer    *rateLimiter
+	methods map[string]*rateLimiter
+	limits  RateLimits
+}
+
+func newRequestLimiter(limits RateLimits) *requestLimiter {
+	methods := make(map[string]*rateLimiter, len(limits.Methods))
+	for method, limit := range limits.Methods {
+		methods[method] = newRateLimiter(limit.RateLimit)
+	}
+	return &requestLimiter{
+		peer:    newRateLimiter(limits.Peer),
+		methods: methods,
+		limits:  limits,
+	}
+}
+
+// check returns an error if the call of caller to method with req goes
+// over one of the limits.
+func (l *requestLimiter) check(caller, method string, req interface{}) error {
+	if limit, ok := l.limits.Methods[method]; ok && limit.MaxMsgBytes > 0 {
+		if msg, ok := req.(pb.Message); ok {
+			if size := pb.Size(msg); size > limit.MaxMsgBytes {
+				return fmt.Errorf("%w: %s got %d bytes, max %d", ErrMessageTooLarge, method, size, limit.MaxMsgBytes)
+			}
+		}
+	}
+	if !l.peer.Allow(caller) {
+		return ErrRateLimited
+	}
+	if m, ok := l.methods[method]; ok && !m.Allow(caller) {
+		return fmt.Errorf("%w: %s", ErrRateLimited, method)
+	}
+	return nil
+}
+
+// serverOptions returns the options installing the limits on a gRPC server.
+func (n *Node) serverOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.MaxConcurrentStreams(n.RateLimits.MaxConcurrentStreams),
+		grpc.MaxRecvMsgSize(n.RateLimits.MaxRecvMsgBytes),
+		grpc.UnaryInterceptor(n.limitUnary),
+	}
+}
+
+// limitUnary is the interceptor rejecting the calls over the limits, which
+// counts as misbehaviour of the caller.
+func (n *Node) limitUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := n.limiter.check(n.callerKey(ctx), info.FullMethod, req); err != nil {
+		penalty := penaltyRateLimit
+		if errors.Is(err, ErrMessageTooLarge) {
+			penalty = penaltySpam
+		}
+		n.misbehaving(ctx, penalty, err)
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// callerKey identifies the caller the limits are applied to: its identity
+// once authenticated, its IP otherwise so it can't get fresh buckets by
+// opening new connections.
+func (n *Node) callerKey(ctx context.Context) string {
+	if id, ok := n.callerID(ctx); ok {
+		return id
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
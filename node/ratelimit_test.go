@@ -0,0 +1,78 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vazj/blocker/proto"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter(RateLimit{Rate: 2, Burst: 3})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, l.Allow("a"))
+	}
+	assert.False(t, l.Allow("a"))
+	// every caller has its own bucket
+	assert.True(t, l.Allow("b"))
+
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, l.Allow("a"))
+	assert.False(t, l.Allow("a"))
+
+	// the bucket never holds more than the burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.True(t, l.Allow("a"))
+	}
+	assert.False(t, l.Allow("a"))
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	l := newRateLimiter(RateLimit{})
+	for i := 0; i < 100; i++ {
+		assert.True(t, l.Allow("a"))
+	}
+}
+
+func TestRequestLimiterMessageSize(t *testing.T) {
+	l := newRequestLimiter(RateLimits{
+		Methods: map[string]MethodLimit{
+			"/Node/HandleTransaction": {MaxMsgBytes: 200},
+		},
+	})
+	assert.NoError(t, l.check("a", "/Node/HandleTransaction", signedTx(1)))
+	assert.ErrorIs(t, l.check("a", "/Node/HandleTransaction", signedTx(10)), ErrMessageTooLarge)
+	// other methods are not capped
+	assert.NoError(t, l.check("a", "/Node/HandleInv", &proto.Inv{Items: make([]*proto.InvItem, 10)}))
+}
+
+func TestRateLimitPenalizesPeer(t *testing.T) {
+	limits := DefaultRateLimits(DefaultConsensusParams())
+	limits.Methods["/Node/HandleTransaction"] = MethodLimit{RateLimit: RateLimit{Rate: 0.01, Burst: 2}}
+	nodeA, addrA := startNode(t, ServerConfig{RateLimits: limits})
+	nodeB, _ := startNode(t, ServerConfig{}, addrA)
+	require.Eventually(t, func() bool {
+		return connected(nodeA, nodeB)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	p, ok := nodeB.peers.Get(nodeID(nodeA))
+	require.True(t, ok)
+	for i := 0; i < 2; i++ {
+		_, err := p.client.HandleTransaction(context.Background(), signedTx(1))
+		require.NoError(t, err)
+	}
+	_, err := p.client.HandleTransaction(context.Background(), signedTx(1))
+	assert.ErrorContains(t, err, ErrRateLimited.Error())
+	assert.Equal(t, penaltyRateLimit, nodeA.peers.Score(nodeID(nodeB)))
+
+	// the limit is per method
+	_, err = p.client.Ping(context.Background(), &proto.Ack{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,34 @@
+package node
+
+import (
+	"context"
+	"sync/atomic"
+
+	"google.golang.org/grpc/stats"
+)
+
+// trafficStats counts the bytes a node sends and receives over gRPC, both
+// as a server and as a client of its peers.
+type trafficStats struct {
+	received atomic.Int64
+	sent     atomic.Int64
+}
+
+func (s *trafficStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (s *trafficStats) HandleRPC(ctx context.Context, rs stats.RPCStats) {
+	switch v := rs.(type) {
+	case *stats.InPayload:
+		s.received.Add(int64(v.WireLength))
+	case *stats.OutPayload:
+		s.sent.Add(int64(v.WireLength))
+	}
+}
+
+func (s *trafficStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (s *trafficStats) HandleConn(context.Context, stats.ConnStats) {}
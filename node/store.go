@@ -2,6 +2,7 @@ package node
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"sync"
 
@@ -9,9 +10,14 @@ import (
 	"github.com/vazj/blocker/types"
 )
 
+// ErrUTXONotFound is returned for outputs that were never created, or not
+// yet.
+var ErrUTXONotFound = errors.New("utxo doesn't exist")
+
 type UTXOStorer interface {
 	Put(*UTXO) error
 	Get(string) (*UTXO, error)
+	Delete(string) error
 }
 
 type MemoryUTXOStore struct {
@@ -30,22 +36,29 @@ func (s *MemoryUTXOStore) Get(hash string) (*UTXO, error) {
 	defer s.lock.RUnlock()
 	utxo, ok := s.data[hash]
 	if !ok {
-		return nil, fmt.Errorf("utxo with hash[%s] doesn't exist", hash)
+		return nil, fmt.Errorf("%w: hash[%s]", ErrUTXONotFound, hash)
 	}
 	return utxo, nil
 }
 
+func (s *MemoryUTXOStore) Delete(hash string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.data, hash)
+	return nil
+}
+
 func (s *MemoryUTXOStore) Put(utxo *UTXO) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
-	key := fmt.Sprintf("%s_%d", utxo.Hash, utxo.OutIndex)
-	s.data[key] = utxo
+	s.data[utxoKey(utxo.Hash, utxo.OutIndex)] = utxo
 	return nil
 }
 
 type TXStorer interface {
 	Put(*proto.Transaction) error
 	Get(string) (*proto.Transaction, error)
+	Delete(string) error
 }
 
 type MemoryTXStore struct {
@@ -69,6 +82,13 @@ func (s *MemoryTXStore) Get(hash string) (*proto.Transaction, error) {
 	return tx, nil
 }
 
+func (s *MemoryTXStore) Delete(hash string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.txx, hash)
+	return nil
+}
+
 func (s *MemoryTXStore) Put(tx *proto.Transaction) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -79,6 +99,7 @@ func (s *MemoryTXStore) Put(tx *proto.Transaction) error {
 type BlockStorer interface {
 	Put(*proto.Block) error
 	Get(string) (*proto.Block, error)
+	Delete(string) error
 }
 
 type MemoryBlockStore struct {
@@ -102,6 +123,13 @@ func (s *MemoryBlockStore) Get(hash string) (*proto.Block, error) {
 	return block, nil
 }
 
+func (s *MemoryBlockStore) Delete(hash string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.blocks, hash)
+	return nil
+}
+
 func (s *MemoryBlockStore) Put(block *proto.Block) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -0,0 +1,237 @@
+package node
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/vazj/blocker/crypto"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// identityCertValidity is how long the certificates derived from the
+// identity key are valid for. They are regenerated on every start.
+const identityCertValidity = 365 * 24 * time.Hour
+
+var ErrUntrustedPeer = errors.New("peer certificate is not trusted")
+
+type TLSConfig struct {
+	// Enabled switches node to node gRPC traffic to TLS.
+	Enabled bool
+	// CertFile and KeyFile are a PEM encoded certificate and key. When they
+	// are empty a self-signed certificate is derived from the identity key.
+	CertFile string
+	KeyFile  string
+	// CAFile is a PEM bundle of the authorities peer certificates have to
+	// chain up to. Such certificates are not bound to identity keys, only
+	// the signed handshake authenticates the identity of a peer then. When
+	// empty, peers have to present a self-signed certificate, which binds
+	// the connection to their identity key.
+	CAFile string
+	// MutualTLS makes the server require and verify client certificates.
+	MutualTLS bool
+	// TrustedIdentities are the hex encoded identity public keys we are
+	// willing to peer with. An empty list trusts any identity. They are
+	// checked against self-signed certificates and so can't be combined
+	// with CAFile.
+	TrustedIdentities []string
+}
+
+// NewIdentityCertificate creates a self-signed certificate for the ed25519
+// identity key of a node.
+func NewIdentityCertificate(identity *crypto.PrivateKey) (tls.Certificate, error) {
+	var (
+		key    = ed25519.PrivateKey(identity.Bytes())
+		pubKey = identity.Public().Bytes()
+		now    = time.Now()
+	)
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hex.EncodeToString(pubKey)},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(identityCertValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// identityFromCert returns the ed25519 public key a certificate is issued
+// for, or nil if it isn't an ed25519 certificate.
+func identityFromCert(cert *x509.Certificate) []byte {
+	pubKey, ok := cert.PublicKey.(ed25519.PublicKey)
+	if !ok {
+		return nil
+	}
+	return pubKey
+}
+
+// checkPeerIdentity makes sure the certificate the remote end of a
+// connection presented, if any, was issued for the identity key it claims.
+func (c TLSConfig) checkPeerIdentity(p *peer.Peer, pubKey []byte) error {
+	// certificates issued by an authority are not bound to identities
+	if !c.Enabled || c.CAFile != "" || p == nil {
+		return nil
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return nil
+	}
+	if !bytes.Equal(identityFromCert(tlsInfo.State.PeerCertificates[0]), pubKey) {
+		return fmt.Errorf("%w: certificate doesn't match the peer identity", ErrUntrustedPeer)
+	}
+	return nil
+}
+
+// credentials builds the transport credentials for both ends of node to
+// node connections.
+func (c TLSConfig) credentials(identity *crypto.PrivateKey) (server, client credentials.TransportCredentials, err error) {
+	cert, err := c.certificate(identity)
+	if err != nil {
+		return nil, nil, err
+	}
+	verify, err := c.peerVerifier()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serverConfig := &tls.Config{
+		Certificates:          []tls.Certificate{cert},
+		MinVersion:            tls.VersionTLS13,
+		ClientAuth:            tls.NoClientCert,
+		VerifyPeerCertificate: verify,
+	}
+	if c.MutualTLS {
+		serverConfig.ClientAuth = tls.RequireAnyClientCert
+	}
+
+	// Peers are dialed by address and authenticated by verify instead of
+	// their host name, hence the default verification is skipped.
+	clientConfig := &tls.Config{
+		Certificates:          []tls.Certificate{cert},
+		MinVersion:            tls.VersionTLS13,
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: verify,
+	}
+	return credentials.NewTLS(serverConfig), credentials.NewTLS(clientConfig), nil
+}
+
+// ClientCredentials returns the transport credentials of a client of a
+// node, such as a wallet, presenting the certificate of c or one derived
+// from identity and verifying the node the way peers do.
+func (c TLSConfig) ClientCredentials(identity *crypto.PrivateKey) (credentials.TransportCredentials, error) {
+	_, client, err := c.credentials(identity)
+	return client, err
+}
+
+func (c TLSConfig) certificate(identity *crypto.PrivateKey) (tls.Certificate, error) {
+	if c.CertFile == "" && c.KeyFile == "" {
+		return NewIdentityCertificate(identity)
+	}
+	return tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+}
+
+// peerVerifier returns the function verifying the certificate chain
+// presented by the other end of a connection.
+func (c TLSConfig) peerVerifier() (func([][]byte, [][]*x509.Certificate) error, error) {
+	if c.CAFile != "" && len(c.TrustedIdentities) > 0 {
+		return nil, errors.New("trusted identities can't be checked against certificates issued by an authority")
+	}
+	var roots *x509.CertPool
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+	}
+
+	trusted := make([][]byte, 0, len(c.TrustedIdentities))
+	for _, s := range c.TrustedIdentities {
+		pubKey, err := hex.DecodeString(s)
+		if err != nil || len(pubKey) != crypto.PubKeyLen {
+			return nil, fmt.Errorf("invalid trusted identity %q", s)
+		}
+		trusted = append(trusted, pubKey)
+	}
+
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("%w: no certificate presented", ErrUntrustedPeer)
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+		leaf := certs[0]
+
+		if roots != nil {
+			intermediates := x509.NewCertPool()
+			for _, cert := range certs[1:] {
+				intermediates.AddCert(cert)
+			}
+			_, err := leaf.Verify(x509.VerifyOptions{
+				Roots:         roots,
+				Intermediates: intermediates,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			})
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrUntrustedPeer, err)
+			}
+		} else {
+			if err := leaf.CheckSignatureFrom(leaf); err != nil {
+				return fmt.Errorf("%w: %s", ErrUntrustedPeer, err)
+			}
+			now := time.Now()
+			if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+				return fmt.Errorf("%w: certificate expired or not yet valid", ErrUntrustedPeer)
+			}
+		}
+
+		if len(trusted) == 0 {
+			return nil
+		}
+		identity := identityFromCert(leaf)
+		for _, pubKey := range trusted {
+			if bytes.Equal(pubKey, identity) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: unknown identity", ErrUntrustedPeer)
+	}, nil
+}
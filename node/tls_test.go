@@ -0,0 +1,154 @@
+package node
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vazj/blocker/crypto"
+)
+
+func TestNewIdentityCertificate(t *testing.T) {
+	identity := crypto.GeneratePrivateKey()
+	cert, err := NewIdentityCertificate(identity)
+	require.NoError(t, err)
+	assert.Equal(t, identity.Public().Bytes(), identityFromCert(cert.Leaf))
+	assert.Equal(t, hex.EncodeToString(identity.Public().Bytes()), cert.Leaf.Subject.CommonName)
+
+	verify, err := TLSConfig{}.peerVerifier()
+	require.NoError(t, err)
+	assert.NoError(t, verify(cert.Certificate, nil))
+	assert.ErrorIs(t, verify(nil, nil), ErrUntrustedPeer)
+
+	// certificates issued by an authority carry no identity to check
+	_, err = TLSConfig{
+		CAFile:            "ca.crt",
+		TrustedIdentities: []string{hex.EncodeToString(identity.Public().Bytes())},
+	}.peerVerifier()
+	assert.Error(t, err)
+}
+
+func TestTLSNodesConnect(t *testing.T) {
+	tlsConfig := TLSConfig{Enabled: true, MutualTLS: true}
+	nodeA, addrA := startNode(t, ServerConfig{TLS: tlsConfig})
+	nodeB, _ := startNode(t, ServerConfig{TLS: tlsConfig}, addrA)
+
+	require.Eventually(t, func() bool {
+		return connected(nodeA, nodeB)
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestTLSRejectsPlaintextPeer(t *testing.T) {
+	nodeA, addrA := startNode(t, ServerConfig{TLS: TLSConfig{Enabled: true, MutualTLS: true}})
+	nodeB, _ := startNode(t, ServerConfig{}, addrA)
+
+	assert.Never(t, func() bool {
+		return nodeA.peers.Len() > 0 || nodeB.peers.Len() > 0
+	}, 500*time.Millisecond, 50*time.Millisecond)
+}
+
+func TestTLSTrustedIdentities(t *testing.T) {
+	var (
+		identityA = crypto.GeneratePrivateKey()
+		identityB = crypto.GeneratePrivateKey()
+		trusted   = []string{
+			hex.EncodeToString(identityA.Public().Bytes()),
+			hex.EncodeToString(identityB.Public().Bytes()),
+		}
+		tlsConfig = TLSConfig{Enabled: true, MutualTLS: true, TrustedIdentities: trusted}
+	)
+	nodeA, addrA := startNode(t, ServerConfig{IdentityKey: identityA, TLS: tlsConfig})
+	nodeB, _ := startNode(t, ServerConfig{IdentityKey: identityB, TLS: tlsConfig}, addrA)
+	require.Eventually(t, func() bool {
+		return connected(nodeA, nodeB)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// an operator nobody trusts
+	nodeC, _ := startNode(t, ServerConfig{TLS: tlsConfig}, addrA)
+	assert.Never(t, func() bool {
+		return nodeC.peers.Len() > 0
+	}, 500*time.Millisecond, 50*time.Millisecond)
+	assert.Equal(t, 1, nodeA.peers.Len())
+}
+
+func TestTLSCertificateAuthority(t *testing.T) {
+	var (
+		dir            = t.TempDir()
+		caKey, caCert  = newTestCA(t)
+		writeNodeFiles = func(name string, signer ed25519.PrivateKey, parent *x509.Certificate) TLSConfig {
+			pub, key, err := ed25519.GenerateKey(rand.Reader)
+			require.NoError(t, err)
+			template := &x509.Certificate{
+				SerialNumber: big.NewInt(time.Now().UnixNano()),
+				Subject:      pkix.Name{CommonName: name},
+				NotBefore:    time.Now().Add(-time.Hour),
+				NotAfter:     time.Now().Add(time.Hour),
+				KeyUsage:     x509.KeyUsageDigitalSignature,
+				ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			}
+			der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+			require.NoError(t, err)
+			keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+			require.NoError(t, err)
+
+			cfg := TLSConfig{
+				Enabled:   true,
+				MutualTLS: true,
+				CertFile:  filepath.Join(dir, name+".crt"),
+				KeyFile:   filepath.Join(dir, name+".key"),
+				CAFile:    filepath.Join(dir, "ca.crt"),
+			}
+			writePEM(t, cfg.CertFile, "CERTIFICATE", der)
+			writePEM(t, cfg.KeyFile, "PRIVATE KEY", keyDer)
+			return cfg
+		}
+	)
+	writePEM(t, filepath.Join(dir, "ca.crt"), "CERTIFICATE", caCert.Raw)
+
+	nodeA, addrA := startNode(t, ServerConfig{TLS: writeNodeFiles("a", caKey, caCert)})
+	nodeB, _ := startNode(t, ServerConfig{TLS: writeNodeFiles("b", caKey, caCert)}, addrA)
+	require.Eventually(t, func() bool {
+		return connected(nodeA, nodeB)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// signed by an authority we don't know
+	otherKey, otherCert := newTestCA(t)
+	nodeC, _ := startNode(t, ServerConfig{TLS: writeNodeFiles("c", otherKey, otherCert)}, addrA)
+	assert.Never(t, func() bool {
+		return nodeC.peers.Len() > 0
+	}, 500*time.Millisecond, 50*time.Millisecond)
+}
+
+func newTestCA(t *testing.T) (ed25519.PrivateKey, *x509.Certificate) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "blocker test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return key, cert
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	b := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(path, b, 0600))
+}
@@ -0,0 +1,57 @@
+package node
+
+import (
+	"fmt"
+	"sync"
+)
+
+// TxLocation is where a transaction of the chain is stored.
+type TxLocation struct {
+	BlockHash []byte
+	Height    int
+	// Index is the position of the transaction in the block.
+	Index int
+}
+
+// TxIndexer maps the hex encoded hash of the transactions of the chain to
+// their location.
+type TxIndexer interface {
+	Put(hash string, loc *TxLocation) error
+	Get(hash string) (*TxLocation, error)
+	Delete(hash string) error
+}
+
+type MemoryTxIndex struct {
+	lock sync.RWMutex
+	locs map[string]*TxLocation
+}
+
+func NewMemoryTxIndex() *MemoryTxIndex {
+	return &MemoryTxIndex{
+		locs: make(map[string]*TxLocation),
+	}
+}
+
+func (idx *MemoryTxIndex) Put(hash string, loc *TxLocation) error {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	idx.locs[hash] = loc
+	return nil
+}
+
+func (idx *MemoryTxIndex) Get(hash string) (*TxLocation, error) {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+	loc, ok := idx.locs[hash]
+	if !ok {
+		return nil, fmt.Errorf("could not find location of tx with hash %s", hash)
+	}
+	return loc, nil
+}
+
+func (idx *MemoryTxIndex) Delete(hash string) error {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	delete(idx.locs, hash)
+	return nil
+}
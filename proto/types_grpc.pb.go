@@ -24,6 +24,12 @@ const _ = grpc.SupportPackageIsVersion7
 type NodeClient interface {
 	Handshake(ctx context.Context, in *Version, opts ...grpc.CallOption) (*Version, error)
 	HandleTransaction(ctx context.Context, in *Transaction, opts ...grpc.CallOption) (*Ack, error)
+	Ping(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*Ack, error)
+	GetChallenge(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*Challenge, error)
+	Identify(ctx context.Context, in *Challenge, opts ...grpc.CallOption) (*Version, error)
+	GetPeers(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*PeerList, error)
+	HandleInv(ctx context.Context, in *Inv, opts ...grpc.CallOption) (*Ack, error)
+	GetData(ctx context.Context, in *Inv, opts ...grpc.CallOption) (*Data, error)
 }
 
 type nodeClient struct {
@@ -52,12 +58,72 @@ func (c *nodeClient) HandleTransaction(ctx context.Context, in *Transaction, opt
 	return out, nil
 }
 
+func (c *nodeClient) Ping(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*Ack, error) {
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, "/Node/Ping", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) GetChallenge(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*Challenge, error) {
+	out := new(Challenge)
+	err := c.cc.Invoke(ctx, "/Node/GetChallenge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) Identify(ctx context.Context, in *Challenge, opts ...grpc.CallOption) (*Version, error) {
+	out := new(Version)
+	err := c.cc.Invoke(ctx, "/Node/Identify", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) GetPeers(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*PeerList, error) {
+	out := new(PeerList)
+	err := c.cc.Invoke(ctx, "/Node/GetPeers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) HandleInv(ctx context.Context, in *Inv, opts ...grpc.CallOption) (*Ack, error) {
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, "/Node/HandleInv", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeClient) GetData(ctx context.Context, in *Inv, opts ...grpc.CallOption) (*Data, error) {
+	out := new(Data)
+	err := c.cc.Invoke(ctx, "/Node/GetData", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // NodeServer is the server API for Node service.
 // All implementations must embed UnimplementedNodeServer
 // for forward compatibility
 type NodeServer interface {
 	Handshake(context.Context, *Version) (*Version, error)
 	HandleTransaction(context.Context, *Transaction) (*Ack, error)
+	Ping(context.Context, *Ack) (*Ack, error)
+	GetChallenge(context.Context, *Ack) (*Challenge, error)
+	Identify(context.Context, *Challenge) (*Version, error)
+	GetPeers(context.Context, *Ack) (*PeerList, error)
+	HandleInv(context.Context, *Inv) (*Ack, error)
+	GetData(context.Context, *Inv) (*Data, error)
 	mustEmbedUnimplementedNodeServer()
 }
 
@@ -71,6 +137,24 @@ func (UnimplementedNodeServer) Handshake(context.Context, *Version) (*Version, e
 func (UnimplementedNodeServer) HandleTransaction(context.Context, *Transaction) (*Ack, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method HandleTransaction not implemented")
 }
+func (UnimplementedNodeServer) Ping(context.Context, *Ack) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
+}
+func (UnimplementedNodeServer) GetChallenge(context.Context, *Ack) (*Challenge, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetChallenge not implemented")
+}
+func (UnimplementedNodeServer) Identify(context.Context, *Challenge) (*Version, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Identify not implemented")
+}
+func (UnimplementedNodeServer) GetPeers(context.Context, *Ack) (*PeerList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPeers not implemented")
+}
+func (UnimplementedNodeServer) HandleInv(context.Context, *Inv) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HandleInv not implemented")
+}
+func (UnimplementedNodeServer) GetData(context.Context, *Inv) (*Data, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetData not implemented")
+}
 func (UnimplementedNodeServer) mustEmbedUnimplementedNodeServer() {}
 
 // UnsafeNodeServer may be embedded to opt out of forward compatibility for this service.
@@ -120,6 +204,114 @@ func _Node_HandleTransaction_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Node_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ack)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).Ping(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/Ping",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).Ping(ctx, req.(*Ack))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_GetChallenge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ack)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).GetChallenge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/GetChallenge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).GetChallenge(ctx, req.(*Ack))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_Identify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Challenge)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).Identify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/Identify",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).Identify(ctx, req.(*Challenge))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_GetPeers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ack)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).GetPeers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/GetPeers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).GetPeers(ctx, req.(*Ack))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_HandleInv_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Inv)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).HandleInv(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/HandleInv",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).HandleInv(ctx, req.(*Inv))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Node_GetData_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Inv)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServer).GetData(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Node/GetData",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServer).GetData(ctx, req.(*Inv))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Node_ServiceDesc is the grpc.ServiceDesc for Node service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -135,6 +327,674 @@ var Node_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "HandleTransaction",
 			Handler:    _Node_HandleTransaction_Handler,
 		},
+		{
+			MethodName: "Ping",
+			Handler:    _Node_Ping_Handler,
+		},
+		{
+			MethodName: "GetChallenge",
+			Handler:    _Node_GetChallenge_Handler,
+		},
+		{
+			MethodName: "Identify",
+			Handler:    _Node_Identify_Handler,
+		},
+		{
+			MethodName: "GetPeers",
+			Handler:    _Node_GetPeers_Handler,
+		},
+		{
+			MethodName: "HandleInv",
+			Handler:    _Node_HandleInv_Handler,
+		},
+		{
+			MethodName: "GetData",
+			Handler:    _Node_GetData_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/types.proto",
+}
+
+// QueryClient is the client API for Query service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type QueryClient interface {
+	GetBlockByHeight(ctx context.Context, in *HeightRequest, opts ...grpc.CallOption) (*Block, error)
+	GetBlockByHash(ctx context.Context, in *HashRequest, opts ...grpc.CallOption) (*Block, error)
+	GetTransaction(ctx context.Context, in *HashRequest, opts ...grpc.CallOption) (*TransactionInfo, error)
+	GetUTXOs(ctx context.Context, in *AddressRequest, opts ...grpc.CallOption) (*UTXOList, error)
+	GetBalance(ctx context.Context, in *AddressRequest, opts ...grpc.CallOption) (*Balance, error)
+	GetChainInfo(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*ChainInfo, error)
+	GetMempool(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*MempoolInfo, error)
+	GetAddressTxs(ctx context.Context, in *AddressRequest, opts ...grpc.CallOption) (*AddressTxs, error)
+	// GetMerkleProof proves the inclusion of a transaction to clients that
+	// only keep the block headers.
+	GetMerkleProof(ctx context.Context, in *HashRequest, opts ...grpc.CallOption) (*MerkleProof, error)
+	GetHeaders(ctx context.Context, in *HeadersRequest, opts ...grpc.CallOption) (*SignedHeaders, error)
+	GetFilterHeaders(ctx context.Context, in *FilterRequest, opts ...grpc.CallOption) (*FilterHeaders, error)
+	GetFilters(ctx context.Context, in *FilterRequest, opts ...grpc.CallOption) (*BlockFilters, error)
+}
+
+type queryClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewQueryClient(cc grpc.ClientConnInterface) QueryClient {
+	return &queryClient{cc}
+}
+
+func (c *queryClient) GetBlockByHeight(ctx context.Context, in *HeightRequest, opts ...grpc.CallOption) (*Block, error) {
+	out := new(Block)
+	err := c.cc.Invoke(ctx, "/Query/GetBlockByHeight", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queryClient) GetBlockByHash(ctx context.Context, in *HashRequest, opts ...grpc.CallOption) (*Block, error) {
+	out := new(Block)
+	err := c.cc.Invoke(ctx, "/Query/GetBlockByHash", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queryClient) GetTransaction(ctx context.Context, in *HashRequest, opts ...grpc.CallOption) (*TransactionInfo, error) {
+	out := new(TransactionInfo)
+	err := c.cc.Invoke(ctx, "/Query/GetTransaction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queryClient) GetUTXOs(ctx context.Context, in *AddressRequest, opts ...grpc.CallOption) (*UTXOList, error) {
+	out := new(UTXOList)
+	err := c.cc.Invoke(ctx, "/Query/GetUTXOs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queryClient) GetBalance(ctx context.Context, in *AddressRequest, opts ...grpc.CallOption) (*Balance, error) {
+	out := new(Balance)
+	err := c.cc.Invoke(ctx, "/Query/GetBalance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queryClient) GetChainInfo(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*ChainInfo, error) {
+	out := new(ChainInfo)
+	err := c.cc.Invoke(ctx, "/Query/GetChainInfo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queryClient) GetMempool(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*MempoolInfo, error) {
+	out := new(MempoolInfo)
+	err := c.cc.Invoke(ctx, "/Query/GetMempool", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queryClient) GetAddressTxs(ctx context.Context, in *AddressRequest, opts ...grpc.CallOption) (*AddressTxs, error) {
+	out := new(AddressTxs)
+	err := c.cc.Invoke(ctx, "/Query/GetAddressTxs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queryClient) GetMerkleProof(ctx context.Context, in *HashRequest, opts ...grpc.CallOption) (*MerkleProof, error) {
+	out := new(MerkleProof)
+	err := c.cc.Invoke(ctx, "/Query/GetMerkleProof", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queryClient) GetHeaders(ctx context.Context, in *HeadersRequest, opts ...grpc.CallOption) (*SignedHeaders, error) {
+	out := new(SignedHeaders)
+	err := c.cc.Invoke(ctx, "/Query/GetHeaders", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queryClient) GetFilterHeaders(ctx context.Context, in *FilterRequest, opts ...grpc.CallOption) (*FilterHeaders, error) {
+	out := new(FilterHeaders)
+	err := c.cc.Invoke(ctx, "/Query/GetFilterHeaders", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queryClient) GetFilters(ctx context.Context, in *FilterRequest, opts ...grpc.CallOption) (*BlockFilters, error) {
+	out := new(BlockFilters)
+	err := c.cc.Invoke(ctx, "/Query/GetFilters", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// QueryServer is the server API for Query service.
+// All implementations must embed UnimplementedQueryServer
+// for forward compatibility
+type QueryServer interface {
+	GetBlockByHeight(context.Context, *HeightRequest) (*Block, error)
+	GetBlockByHash(context.Context, *HashRequest) (*Block, error)
+	GetTransaction(context.Context, *HashRequest) (*TransactionInfo, error)
+	GetUTXOs(context.Context, *AddressRequest) (*UTXOList, error)
+	GetBalance(context.Context, *AddressRequest) (*Balance, error)
+	GetChainInfo(context.Context, *Ack) (*ChainInfo, error)
+	GetMempool(context.Context, *Ack) (*MempoolInfo, error)
+	GetAddressTxs(context.Context, *AddressRequest) (*AddressTxs, error)
+	// GetMerkleProof proves the inclusion of a transaction to clients that
+	// only keep the block headers.
+	GetMerkleProof(context.Context, *HashRequest) (*MerkleProof, error)
+	GetHeaders(context.Context, *HeadersRequest) (*SignedHeaders, error)
+	GetFilterHeaders(context.Context, *FilterRequest) (*FilterHeaders, error)
+	GetFilters(context.Context, *FilterRequest) (*BlockFilters, error)
+	mustEmbedUnimplementedQueryServer()
+}
+
+// UnimplementedQueryServer must be embedded to have forward compatible implementations.
+type UnimplementedQueryServer struct {
+}
+
+func (UnimplementedQueryServer) GetBlockByHeight(context.Context, *HeightRequest) (*Block, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlockByHeight not implemented")
+}
+func (UnimplementedQueryServer) GetBlockByHash(context.Context, *HashRequest) (*Block, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlockByHash not implemented")
+}
+func (UnimplementedQueryServer) GetTransaction(context.Context, *HashRequest) (*TransactionInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTransaction not implemented")
+}
+func (UnimplementedQueryServer) GetUTXOs(context.Context, *AddressRequest) (*UTXOList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUTXOs not implemented")
+}
+func (UnimplementedQueryServer) GetBalance(context.Context, *AddressRequest) (*Balance, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBalance not implemented")
+}
+func (UnimplementedQueryServer) GetChainInfo(context.Context, *Ack) (*ChainInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetChainInfo not implemented")
+}
+func (UnimplementedQueryServer) GetMempool(context.Context, *Ack) (*MempoolInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMempool not implemented")
+}
+func (UnimplementedQueryServer) GetAddressTxs(context.Context, *AddressRequest) (*AddressTxs, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAddressTxs not implemented")
+}
+func (UnimplementedQueryServer) GetMerkleProof(context.Context, *HashRequest) (*MerkleProof, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMerkleProof not implemented")
+}
+func (UnimplementedQueryServer) GetHeaders(context.Context, *HeadersRequest) (*SignedHeaders, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetHeaders not implemented")
+}
+func (UnimplementedQueryServer) GetFilterHeaders(context.Context, *FilterRequest) (*FilterHeaders, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFilterHeaders not implemented")
+}
+func (UnimplementedQueryServer) GetFilters(context.Context, *FilterRequest) (*BlockFilters, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFilters not implemented")
+}
+func (UnimplementedQueryServer) mustEmbedUnimplementedQueryServer() {}
+
+// UnsafeQueryServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to QueryServer will
+// result in compilation errors.
+type UnsafeQueryServer interface {
+	mustEmbedUnimplementedQueryServer()
+}
+
+func RegisterQueryServer(s grpc.ServiceRegistrar, srv QueryServer) {
+	s.RegisterService(&Query_ServiceDesc, srv)
+}
+
+func _Query_GetBlockByHeight_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeightRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueryServer).GetBlockByHeight(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Query/GetBlockByHeight",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueryServer).GetBlockByHeight(ctx, req.(*HeightRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Query_GetBlockByHash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HashRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueryServer).GetBlockByHash(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Query/GetBlockByHash",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueryServer).GetBlockByHash(ctx, req.(*HashRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Query_GetTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HashRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueryServer).GetTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Query/GetTransaction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueryServer).GetTransaction(ctx, req.(*HashRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Query_GetUTXOs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueryServer).GetUTXOs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Query/GetUTXOs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueryServer).GetUTXOs(ctx, req.(*AddressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Query_GetBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueryServer).GetBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Query/GetBalance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueryServer).GetBalance(ctx, req.(*AddressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Query_GetChainInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ack)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueryServer).GetChainInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Query/GetChainInfo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueryServer).GetChainInfo(ctx, req.(*Ack))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Query_GetMempool_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ack)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueryServer).GetMempool(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Query/GetMempool",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueryServer).GetMempool(ctx, req.(*Ack))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Query_GetAddressTxs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueryServer).GetAddressTxs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Query/GetAddressTxs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueryServer).GetAddressTxs(ctx, req.(*AddressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Query_GetMerkleProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HashRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueryServer).GetMerkleProof(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Query/GetMerkleProof",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueryServer).GetMerkleProof(ctx, req.(*HashRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Query_GetHeaders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeadersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueryServer).GetHeaders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Query/GetHeaders",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueryServer).GetHeaders(ctx, req.(*HeadersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Query_GetFilterHeaders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FilterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueryServer).GetFilterHeaders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Query/GetFilterHeaders",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueryServer).GetFilterHeaders(ctx, req.(*FilterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Query_GetFilters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FilterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueryServer).GetFilters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Query/GetFilters",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueryServer).GetFilters(ctx, req.(*FilterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Query_ServiceDesc is the grpc.ServiceDesc for Query service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Query_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "Query",
+	HandlerType: (*QueryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetBlockByHeight",
+			Handler:    _Query_GetBlockByHeight_Handler,
+		},
+		{
+			MethodName: "GetBlockByHash",
+			Handler:    _Query_GetBlockByHash_Handler,
+		},
+		{
+			MethodName: "GetTransaction",
+			Handler:    _Query_GetTransaction_Handler,
+		},
+		{
+			MethodName: "GetUTXOs",
+			Handler:    _Query_GetUTXOs_Handler,
+		},
+		{
+			MethodName: "GetBalance",
+			Handler:    _Query_GetBalance_Handler,
+		},
+		{
+			MethodName: "GetChainInfo",
+			Handler:    _Query_GetChainInfo_Handler,
+		},
+		{
+			MethodName: "GetMempool",
+			Handler:    _Query_GetMempool_Handler,
+		},
+		{
+			MethodName: "GetAddressTxs",
+			Handler:    _Query_GetAddressTxs_Handler,
+		},
+		{
+			MethodName: "GetMerkleProof",
+			Handler:    _Query_GetMerkleProof_Handler,
+		},
+		{
+			MethodName: "GetHeaders",
+			Handler:    _Query_GetHeaders_Handler,
+		},
+		{
+			MethodName: "GetFilterHeaders",
+			Handler:    _Query_GetFilterHeaders_Handler,
+		},
+		{
+			MethodName: "GetFilters",
+			Handler:    _Query_GetFilters_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/types.proto",
+}
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminClient interface {
+	ListPeers(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*PeerInfoList, error)
+	BanPeer(ctx context.Context, in *BanRequest, opts ...grpc.CallOption) (*Ack, error)
+	UnbanPeer(ctx context.Context, in *BanRequest, opts ...grpc.CallOption) (*Ack, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) ListPeers(ctx context.Context, in *Ack, opts ...grpc.CallOption) (*PeerInfoList, error) {
+	out := new(PeerInfoList)
+	err := c.cc.Invoke(ctx, "/Admin/ListPeers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) BanPeer(ctx context.Context, in *BanRequest, opts ...grpc.CallOption) (*Ack, error) {
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, "/Admin/BanPeer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) UnbanPeer(ctx context.Context, in *BanRequest, opts ...grpc.CallOption) (*Ack, error) {
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, "/Admin/UnbanPeer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility
+type AdminServer interface {
+	ListPeers(context.Context, *Ack) (*PeerInfoList, error)
+	BanPeer(context.Context, *BanRequest) (*Ack, error)
+	UnbanPeer(context.Context, *BanRequest) (*Ack, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
+}
+
+func (UnimplementedAdminServer) ListPeers(context.Context, *Ack) (*PeerInfoList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPeers not implemented")
+}
+func (UnimplementedAdminServer) BanPeer(context.Context, *BanRequest) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BanPeer not implemented")
+}
+func (UnimplementedAdminServer) UnbanPeer(context.Context, *BanRequest) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnbanPeer not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_ListPeers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ack)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListPeers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Admin/ListPeers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListPeers(ctx, req.(*Ack))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_BanPeer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).BanPeer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Admin/BanPeer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).BanPeer(ctx, req.(*BanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_UnbanPeer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).UnbanPeer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Admin/UnbanPeer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).UnbanPeer(ctx, req.(*BanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListPeers",
+			Handler:    _Admin_ListPeers_Handler,
+		},
+		{
+			MethodName: "BanPeer",
+			Handler:    _Admin_BanPeer_Handler,
+		},
+		{
+			MethodName: "UnbanPeer",
+			Handler:    _Admin_UnbanPeer_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/types.proto",
@@ -4,79 +4,62 @@ import (
 	"bytes"
 	"crypto/sha256"
 
-	"github.com/cbergoon/merkletree"
-	pb "github.com/golang/protobuf/proto"
 	"github.com/vazj/blocker/crypto"
 	"github.com/vazj/blocker/proto"
 )
 
-type TxHash struct {
-	hash []byte
-}
-
-func NewTxHash(hash []byte) TxHash {
-	return TxHash{hash: hash}
-}
-
-func (t TxHash) CalculateHash() ([]byte, error) {
-	return t.hash, nil
-}
-
-func (t TxHash) Equals(other merkletree.Content) (bool, error) {
-	equals := bytes.Equal(t.hash, other.(TxHash).hash)
-	return equals, nil
-}
+// headerDomain prefixes the encoding of the headers so that their hash
+// can't be mistaken for the one of anything else that gets signed.
+const headerDomain = "blocker/header"
 
 func VerifyBlock(b *proto.Block) bool {
-	if len(b.Transactions) > 0 {
-		if !VerifyRootHash(b) {
-			return false
-		}
-	}
-
-	if len(b.PublicKey) != crypto.PubKeyLen || len(b.Signature) != crypto.SignatureLen {
+	if !VerifyRootHash(b) || !VerifyWitnessRoot(b) || !VerifyFilterHash(b) {
 		return false
 	}
 
-	var (
-		sig    = crypto.SignatureFromBytes(b.Signature)
-		pubKey = crypto.PublicKeyFromBytes(b.PublicKey)
-	)
-
-	return sig.Verify(pubKey, HashBlock(b))
+	return verifyHeaderSignature(b.Header, b.PublicKey, b.Signature)
 }
 
-func VerifyRootHash(b *proto.Block) bool {
-	t, err := GetMerkleTree(b)
-	if err != nil {
+// VerifySignedHeader checks the proposer signature of a header shipped
+// without its transactions.
+func VerifySignedHeader(h *proto.SignedHeader) bool {
+	if h.Header == nil {
 		return false
 	}
+	return verifyHeaderSignature(h.Header, h.PublicKey, h.Signature)
+}
 
-	valid, err := t.VerifyTree()
-	if err != nil {
+// verifyHeaderSignature checks that the proposer of the header signed it.
+func verifyHeaderSignature(header *proto.Header, pubKey, sig []byte) bool {
+	if len(pubKey) != crypto.PubKeyLen || len(sig) != crypto.SignatureLen {
 		return false
 	}
-
-	if len(b.Header.RootHash) == 0 {
+	if !bytes.Equal(header.Proposer, pubKey) {
 		return false
 	}
+	return crypto.SignatureFromBytes(sig).Verify(crypto.PublicKeyFromBytes(pubKey), HashHeader(header))
+}
 
-	if !valid {
+func VerifyRootHash(b *proto.Block) bool {
+	if len(b.Header.RootHash) == 0 {
 		return false
 	}
+	return bytes.Equal(b.Header.RootHash, MerkleRoot(txHashes(b)))
+}
 
-	return bytes.Equal(b.Header.RootHash, t.MerkleRoot())
+// VerifyWitnessRoot checks the commitment of the header of b to the
+// signatures of its transactions.
+func VerifyWitnessRoot(b *proto.Block) bool {
+	return bytes.Equal(b.Header.WitnessRoot, MerkleRoot(witnessHashes(b)))
 }
 
+// SignBlock commits the header of b to its transactions, their filter and
+// pk as the proposer, then signs it.
 func SignBlock(pk *crypto.PrivateKey, b *proto.Block) *crypto.Signature {
-	if len(b.Transactions) > 0 {
-		t, err := GetMerkleTree(b)
-		if err != nil {
-			panic(err)
-		}
-
-		b.Header.RootHash = t.MerkleRoot()
-	}
+	b.Header.RootHash = MerkleRoot(txHashes(b))
+	b.Header.WitnessRoot = MerkleRoot(witnessHashes(b))
+	b.Header.FilterHash = HashFilter(BuildBlockFilter(b).Bytes())
+	b.Header.Proposer = pk.Public().Bytes()
 
 	hash := HashBlock(b)
 	sig := pk.Sign(hash)
@@ -86,17 +69,9 @@ func SignBlock(pk *crypto.PrivateKey, b *proto.Block) *crypto.Signature {
 	return sig
 }
 
-func GetMerkleTree(b *proto.Block) (*merkletree.MerkleTree, error) {
-	list := make([]merkletree.Content, len(b.Transactions))
-	for i := 0; i < len(b.Transactions); i++ {
-		list[i] = NewTxHash(HashTransaction(b.Transactions[i]))
-	}
-	t, err := merkletree.NewTree(list)
-	if err != nil {
-		return nil, err
-	}
-
-	return t, nil
+// GetMerkleTree returns the Merkle tree of the transactions of b.
+func GetMerkleTree(b *proto.Block) *MerkleTree {
+	return NewMerkleTree(txHashes(b))
 }
 
 // Hashblock returns a single SHA256 of the block.
@@ -104,11 +79,25 @@ func HashBlock(block *proto.Block) []byte {
 	return HashHeader(block.Header)
 }
 
+// HashHeader returns the SHA256 of the canonical encoding of the header.
 func HashHeader(header *proto.Header) []byte {
-	b, err := pb.Marshal(header)
-	if err != nil {
-		panic(err)
-	}
-	hash := sha256.Sum256(b)
+	hash := sha256.Sum256(EncodeHeader(header))
 	return hash[:]
 }
+
+// EncodeHeader returns the canonical encoding of the header: the domain,
+// then the fields in a fixed order. There is a single layout, every field
+// the block validation relies on is covered whatever the version says.
+func EncodeHeader(header *proto.Header) []byte {
+	e := &encoder{}
+	e.bytes([]byte(headerDomain))
+	e.int32(header.Version)
+	e.int32(header.Height)
+	e.bytes(header.PrevHash)
+	e.bytes(header.RootHash)
+	e.bytes(header.WitnessRoot)
+	e.bytes(header.FilterHash)
+	e.int64(header.Timestamp)
+	e.bytes(header.Proposer)
+	return e.buf
+}
@@ -1,9 +1,13 @@
 package types
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/vazj/blocker/crypto"
 	"github.com/vazj/blocker/proto"
 	"github.com/vazj/blocker/util"
@@ -49,3 +53,99 @@ func TestHashBlock(t *testing.T) {
 	hash := HashBlock(block)
 	assert.Equal(t, 32, len(hash))
 }
+
+// The hash of a header must never change: blocks are chained and signed
+// with it.
+func TestHashHeaderGoldenVector(t *testing.T) {
+	header := &proto.Header{
+		Version:     3,
+		Height:      7,
+		PrevHash:    bytes.Repeat([]byte{1}, 32),
+		RootHash:    bytes.Repeat([]byte{2}, 32),
+		WitnessRoot: bytes.Repeat([]byte{6}, 32),
+		FilterHash:  bytes.Repeat([]byte{8}, 32),
+		Timestamp:   1700000000000000000,
+		Proposer:    bytes.Repeat([]byte{3}, 32),
+	}
+	assert.Equal(t, "383566af8fa79346b12c020a8babb7d77b999b2b1c1ac7aa38dd453d9625bcd6", hex.EncodeToString(HashHeader(header)))
+
+	// the roots are covered whatever the version
+	header.Version = 1
+	v1 := HashHeader(header)
+	header.WitnessRoot = bytes.Repeat([]byte{7}, 32)
+	assert.NotEqual(t, v1, HashHeader(header))
+}
+
+func TestBlockCommitsToSignatures(t *testing.T) {
+	var (
+		block   = util.RandomBlock()
+		privKey = crypto.GeneratePrivateKey()
+		tx      = &proto.Transaction{
+			Version: 1,
+			Inputs: []*proto.TxInput{{
+				PrevTxHash: util.RandomHash(),
+				PublicKey:  privKey.Public().Bytes(),
+			}},
+		}
+	)
+	tx.Inputs[0].Signature = SignTransaction(privKey, tx).Bytes()
+	block.Transactions = append(block.Transactions, tx)
+	SignBlock(privKey, block)
+	require.True(t, VerifyBlock(block))
+
+	// swapping a signature keeps the IDs, and so the root hash, but not the
+	// witness root
+	tx.Inputs[0].Signature = SignTransaction(crypto.GeneratePrivateKey(), tx).Bytes()
+	assert.True(t, VerifyRootHash(block))
+	assert.False(t, VerifyBlock(block))
+}
+
+func TestHashHeaderIsInjective(t *testing.T) {
+	var (
+		a = &proto.Header{PrevHash: []byte{1, 2}, RootHash: []byte{3}}
+		b = &proto.Header{PrevHash: []byte{1}, RootHash: []byte{2, 3}}
+	)
+	assert.NotEqual(t, HashHeader(a), HashHeader(b))
+}
+
+func TestEmptyBlockCommitsToEmptyRoot(t *testing.T) {
+	var (
+		block   = util.RandomBlock()
+		privKey = crypto.GeneratePrivateKey()
+		empty   = sha256.Sum256(nil)
+	)
+	assert.Equal(t, empty[:], EmptyRootHash())
+
+	SignBlock(privKey, block)
+	assert.Equal(t, EmptyRootHash(), block.Header.RootHash)
+
+	// the root of a block is its own, changing it changes nothing else
+	block.Header.RootHash[0] ^= 1
+	assert.Equal(t, empty[:], EmptyRootHash())
+	assert.Equal(t, empty[:], MerkleRoot(nil))
+	block.Header.RootHash[0] ^= 1
+	assert.True(t, VerifyBlock(block))
+
+	// a transaction slipped in an empty block is caught
+	block.Transactions = append(block.Transactions, &proto.Transaction{Version: 1})
+	assert.False(t, VerifyBlock(block))
+}
+
+func TestHeaderBindsProposer(t *testing.T) {
+	var (
+		block   = util.RandomBlock()
+		privKey = crypto.GeneratePrivateKey()
+	)
+	SignBlock(privKey, block)
+	assert.Equal(t, privKey.Public().Bytes(), block.Header.Proposer)
+
+	other := crypto.GeneratePrivateKey()
+	block.Header.Proposer = other.Public().Bytes()
+	assert.False(t, VerifyBlock(block))
+
+	// re-signing the same hash with another key doesn't make it valid
+	block.Header.Proposer = privKey.Public().Bytes()
+	block.PublicKey = other.Public().Bytes()
+	block.Signature = other.Sign(HashBlock(block)).Bytes()
+	assert.False(t, VerifyBlock(block))
+}
@@ -0,0 +1,29 @@
+package types
+
+import (
+	"encoding/binary"
+)
+
+// encoder writes the canonical binary encoding hashes are computed over.
+// Integers are big endian and byte fields are prefixed with their length,
+// so that no two different values share an encoding.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, v)
+}
+
+func (e *encoder) int32(v int32) {
+	e.uint32(uint32(v))
+}
+
+func (e *encoder) int64(v int64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v))
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint32(uint32(len(b)))
+	e.buf = append(e.buf, b...)
+}
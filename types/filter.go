@@ -0,0 +1,79 @@
+package types
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/vazj/blocker/gcs"
+	"github.com/vazj/blocker/proto"
+)
+
+// FilterKey returns the key the items of the filter of a block are hashed
+// with, the first bytes of the hash of the previous block. The hash of the
+// block itself can't be used since its header commits to the filter.
+func FilterKey(prevHash []byte) [gcs.KeyLen]byte {
+	var key [gcs.KeyLen]byte
+	copy(key[:], prevHash)
+	return key
+}
+
+// OutpointBytes is the filter item of the output at index of the
+// transaction with the given hash.
+func OutpointBytes(txHash []byte, index uint32) []byte {
+	b := make([]byte, len(txHash)+4)
+	copy(b, txHash)
+	binary.BigEndian.PutUint32(b[len(txHash):], index)
+	return b
+}
+
+// BlockFilterItems returns the addresses the block pays to and the
+// outpoints it spends.
+func BlockFilterItems(b *proto.Block) [][]byte {
+	items := make([][]byte, 0)
+	for _, tx := range b.Transactions {
+		for _, output := range tx.Outputs {
+			items = append(items, output.Address)
+		}
+		for _, input := range tx.Inputs {
+			items = append(items, OutpointBytes(input.PrevTxHash, input.PrevOutIndex))
+		}
+	}
+	return items
+}
+
+// BuildBlockFilter returns the compact filter of b, which light clients
+// match their addresses and outputs against to find out whether they need
+// the block.
+func BuildBlockFilter(b *proto.Block) *gcs.Filter {
+	return gcs.Build(FilterKey(b.Header.PrevHash), BlockFilterItems(b))
+}
+
+// HashFilter returns the hash of a serialized filter, the one block headers
+// commit to.
+func HashFilter(filter []byte) []byte {
+	hash := sha256.Sum256(filter)
+	return hash[:]
+}
+
+// VerifyFilterHash checks the commitment of the header of b to its filter.
+func VerifyFilterHash(b *proto.Block) bool {
+	return bytes.Equal(b.Header.FilterHash, HashFilter(BuildBlockFilter(b).Bytes()))
+}
+
+// FilterHeader chains the serialized filter of a block to the filter
+// header of the previous block, the one of the genesis being chained to
+// 32 zero bytes.
+func FilterHeader(filter []byte, prevHeader []byte) []byte {
+	return NextFilterHeader(HashFilter(filter), prevHeader)
+}
+
+// NextFilterHeader chains the filter hash a header commits to to the
+// filter header of the previous block. This lets the holder of the
+// headers compute the filter headers without the filters.
+func NextFilterHeader(filterHash []byte, prevHeader []byte) []byte {
+	h := sha256.New()
+	h.Write(filterHash)
+	h.Write(prevHeader)
+	return h.Sum(nil)
+}
@@ -0,0 +1,63 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/gcs"
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/util"
+)
+
+func TestBuildBlockFilter(t *testing.T) {
+	var (
+		recipient = crypto.GeneratePrivateKey().Public().Address().Bytes()
+		prevHash  = util.RandomHash()
+		block     = util.RandomBlock()
+	)
+	block.Transactions = append(block.Transactions, &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{{PrevTxHash: prevHash, PrevOutIndex: 3}},
+		Outputs: []*proto.TxOutput{{Amount: 10, Address: recipient}},
+	})
+
+	filter, err := gcs.FromBytes(BuildBlockFilter(block).Bytes())
+	assert.NoError(t, err)
+	key := FilterKey(block.Header.PrevHash)
+	assert.True(t, filter.Match(key, recipient))
+	assert.True(t, filter.Match(key, OutpointBytes(prevHash, 3)))
+	assert.False(t, filter.Match(key, OutpointBytes(prevHash, 2)))
+	assert.False(t, filter.Match(key, crypto.GeneratePrivateKey().Public().Address().Bytes()))
+}
+
+func TestBlockCommitsToFilter(t *testing.T) {
+	var (
+		privKey = crypto.GeneratePrivateKey()
+		block   = util.RandomBlock()
+	)
+	block.Transactions = append(block.Transactions, &proto.Transaction{
+		Version: 1,
+		Outputs: []*proto.TxOutput{{Amount: 10, Address: privKey.Public().Address().Bytes()}},
+	})
+	SignBlock(privKey, block)
+	assert.Equal(t, HashFilter(BuildBlockFilter(block).Bytes()), block.Header.FilterHash)
+	assert.True(t, VerifyBlock(block))
+
+	block.Header.FilterHash = HashFilter(nil)
+	assert.False(t, VerifyFilterHash(block))
+	assert.False(t, VerifyBlock(block))
+}
+
+func TestFilterHeaderChains(t *testing.T) {
+	var (
+		zero   = make([]byte, 32)
+		first  = FilterHeader([]byte{0}, zero)
+		second = FilterHeader([]byte{0}, first)
+	)
+	assert.Len(t, first, 32)
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, second, FilterHeader([]byte{0}, first))
+	assert.NotEqual(t, first, FilterHeader([]byte{1}, zero))
+	assert.Equal(t, first, NextFilterHeader(HashFilter([]byte{0}), zero))
+}
@@ -0,0 +1,256 @@
+package types
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/vazj/blocker/proto"
+)
+
+// The leaves and the inner nodes of the Merkle tree are hashed with a
+// different prefix, so that an inner node can't be passed off as a leaf.
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// emptyMerkleRoot is the root of a tree without leaves.
+var emptyMerkleRoot = sha256.Sum256(nil)
+
+// EmptyRootHash returns the root hash of a block without transactions, the
+// SHA256 of nothing. Every call returns a new copy.
+func EmptyRootHash() []byte {
+	root := emptyMerkleRoot
+	return root[:]
+}
+
+// HashMerkleLeaf returns the hash of the leaf of data in a Merkle tree.
+func HashMerkleLeaf(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func hashMerkleNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// MerkleTree is a binary Merkle tree. A node left without a sibling, at
+// the end of an odd level, is moved up a level as is rather than hashed
+// with a copy of itself, which would let two lists of leaves share a root.
+// The shape is the one of RFC 9162: the left subtree of a node is the
+// largest perfect tree that fits.
+type MerkleTree struct {
+	// levels are the hashes of the nodes from the leaves up to the root.
+	levels [][][]byte
+}
+
+// NewMerkleTree builds the tree of the given items, every one of them
+// being hashed into a leaf.
+func NewMerkleTree(items [][]byte) *MerkleTree {
+	level := make([][]byte, len(items))
+	for i, item := range items {
+		level[i] = HashMerkleLeaf(item)
+	}
+	t := &MerkleTree{levels: [][][]byte{level}}
+	for len(level) > 1 {
+		level = merkleParents(level)
+		t.levels = append(t.levels, level)
+	}
+	return t
+}
+
+// merkleParents hashes the nodes of a level by pairs.
+func merkleParents(level [][]byte) [][]byte {
+	parents := make([][]byte, 0, (len(level)+1)/2)
+	for i := 0; i+1 < len(level); i += 2 {
+		parents = append(parents, hashMerkleNode(level[i], level[i+1]))
+	}
+	if len(level)%2 == 1 {
+		parents = append(parents, level[len(level)-1])
+	}
+	return parents
+}
+
+// Len returns the number of leaves of the tree.
+func (t *MerkleTree) Len() int {
+	return len(t.levels[0])
+}
+
+// Root returns the root hash of the tree.
+func (t *MerkleTree) Root() []byte {
+	top := t.levels[len(t.levels)-1]
+	if len(top) == 0 {
+		return EmptyRootHash()
+	}
+	return top[0]
+}
+
+// Proof returns the hashes of the siblings of the path from the leaf at
+// index up to the root, skipping the levels the path is moved up as is.
+func (t *MerkleTree) Proof(index int) ([][]byte, error) {
+	if index < 0 || index >= t.Len() {
+		return nil, fmt.Errorf("tree has no leaf at index %d", index)
+	}
+	hashes := make([][]byte, 0, len(t.levels))
+	for _, level := range t.levels[:len(t.levels)-1] {
+		if sibling := index ^ 1; sibling < len(level) {
+			hashes = append(hashes, level[sibling])
+		}
+		index /= 2
+	}
+	return hashes, nil
+}
+
+// MerkleAccumulator computes the root of a tree one leaf at a time, only
+// keeping the roots of the perfect subtrees built so far.
+type MerkleAccumulator struct {
+	n uint64
+	// roots are the roots of the perfect subtrees, the largest first,
+	// matching the set bits of n.
+	roots [][]byte
+}
+
+// Add appends a leaf for item.
+func (a *MerkleAccumulator) Add(item []byte) {
+	node := HashMerkleLeaf(item)
+	// merge the subtrees of the same size as the carries of an addition
+	for n := a.n; n&1 == 1; n >>= 1 {
+		last := len(a.roots) - 1
+		node = hashMerkleNode(a.roots[last], node)
+		a.roots = a.roots[:last]
+	}
+	a.roots = append(a.roots, node)
+	a.n++
+}
+
+// Len returns the number of leaves added.
+func (a *MerkleAccumulator) Len() int {
+	return int(a.n)
+}
+
+// Root returns the root of the tree of the leaves added so far.
+func (a *MerkleAccumulator) Root() []byte {
+	if len(a.roots) == 0 {
+		return EmptyRootHash()
+	}
+	root := a.roots[len(a.roots)-1]
+	for i := len(a.roots) - 2; i >= 0; i-- {
+		root = hashMerkleNode(a.roots[i], root)
+	}
+	return root
+}
+
+// MerkleRoot returns the root of the tree of items without building it.
+func MerkleRoot(items [][]byte) []byte {
+	a := &MerkleAccumulator{}
+	for _, item := range items {
+		a.Add(item)
+	}
+	return a.Root()
+}
+
+// txHashes returns the hashes of the transactions of b, the items of its
+// Merkle tree.
+func txHashes(b *proto.Block) [][]byte {
+	hashes := make([][]byte, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		hashes[i] = HashTransaction(tx)
+	}
+	return hashes
+}
+
+// witnessHashes returns the witness hashes of the transactions of b, the
+// items of its witness commitment.
+func witnessHashes(b *proto.Block) [][]byte {
+	hashes := make([][]byte, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		hashes[i] = WitnessHash(tx)
+	}
+	return hashes
+}
+
+// NewMerkleProof returns the proof that the transaction at index is part of
+// the Merkle tree of b.
+func NewMerkleProof(b *proto.Block, index int) (*proto.MerkleProof, error) {
+	if index < 0 || index >= len(b.Transactions) {
+		return nil, fmt.Errorf("block has no transaction at index %d", index)
+	}
+	hashes, err := GetMerkleTree(b).Proof(index)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.MerkleProof{
+		TxHash: HashTransaction(b.Transactions[index]),
+		Index:  uint32(index),
+		Total:  uint32(len(b.Transactions)),
+		Hashes: hashes,
+	}, nil
+}
+
+// NewMerkleProofForTx returns the proof that the transaction with the given
+// hash is part of b.
+func NewMerkleProofForTx(b *proto.Block, txHash []byte) (*proto.MerkleProof, error) {
+	for i, tx := range b.Transactions {
+		if bytes.Equal(HashTransaction(tx), txHash) {
+			return NewMerkleProof(b, i)
+		}
+	}
+	return nil, fmt.Errorf("block doesn't include tx with hash %x", txHash)
+}
+
+// maxMerkleProofLen is the length of the proof of a tree with 2^32 leaves,
+// more than the index of a proof can address.
+const maxMerkleProofLen = 32
+
+// VerifyMerkleProof checks that proof leads from its transaction hash to
+// root. This is the inclusion proof verification of RFC 9162.
+func VerifyMerkleProof(proof *proto.MerkleProof, root []byte) bool {
+	if proof == nil || len(proof.TxHash) != sha256.Size || len(proof.Hashes) > maxMerkleProofLen {
+		return false
+	}
+	if proof.Index >= proof.Total {
+		return false
+	}
+	var (
+		hash = HashMerkleLeaf(proof.TxHash)
+		// fn is the index of the node on the path, sn the one of the last
+		// node of its level.
+		fn = proof.Index
+		sn = proof.Total - 1
+	)
+	for _, sibling := range proof.Hashes {
+		if len(sibling) != sha256.Size || sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			hash = hashMerkleNode(sibling, hash)
+			// skip the levels where the node has no sibling
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			hash = hashMerkleNode(hash, sibling)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(hash, root)
+}
+
+// VerifyTxInclusion checks, without the block, that proof shows tx to be
+// included in the block of header. This is what light clients rely on to
+// accept a payment.
+func VerifyTxInclusion(header *proto.Header, tx *proto.Transaction, proof *proto.MerkleProof) bool {
+	if header == nil || proof == nil || !bytes.Equal(HashTransaction(tx), proof.TxHash) {
+		return false
+	}
+	return VerifyMerkleProof(proof, header.RootHash)
+}
@@ -0,0 +1,156 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	pb "github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/util"
+)
+
+// blockWithTxs returns a block with n distinct transactions.
+func blockWithTxs(n int) *proto.Block {
+	block := util.RandomBlock()
+	for i := 0; i < n; i++ {
+		block.Transactions = append(block.Transactions, &proto.Transaction{
+			Version: int32(i),
+		})
+	}
+	return block
+}
+
+// goldenItems returns the items of the golden vectors, the hash of their
+// index.
+func goldenItems(n int) [][]byte {
+	items := make([][]byte, n)
+	for i := range items {
+		hash := sha256.Sum256([]byte{byte(i)})
+		items[i] = hash[:]
+	}
+	return items
+}
+
+// The roots must never change: blocks commit to them.
+func TestMerkleRootGoldenVectors(t *testing.T) {
+	golden := map[int]string{
+		0:  "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		1:  "d9de27625445003d8a9739a851e3ff8d41c0683630b4d63a88327a6aaa37c409",
+		2:  "604d540f09268b91672ab011394d5266ccd7d4484d0d109411a55848126a1b2c",
+		3:  "d1f13800048f5909d4043fc0c152f6643280cba608b672715e56ce159a20629f",
+		4:  "0dcc2b645c00dfa2338e1c7ac2c4b570beda5a476d58836e55e28bde55e6bee1",
+		5:  "6b313b611b40676b9e1dfd70c4503f2379f88f0f1c2740fb7e1cacc32c113465",
+		7:  "bee2275db16667589a4515f63e0d053a2fa602c1d9f9703e98920a5bdad59baf",
+		8:  "80e139b44c90f91edebec705cc7586c3d90f4bdadd49628d25c20d4b03419287",
+		16: "cc6e692ad24b6d105fa005c1028345bd7fd47c0221444ae3e6b9aa3708cacfc2",
+	}
+	for n, root := range golden {
+		items := goldenItems(n)
+		assert.Equal(t, root, hex.EncodeToString(MerkleRoot(items)), "%d items", n)
+		assert.Equal(t, root, hex.EncodeToString(NewMerkleTree(items).Root()), "%d items", n)
+	}
+}
+
+func TestMerkleAccumulatorMatchesTree(t *testing.T) {
+	var (
+		items = goldenItems(40)
+		acc   = &MerkleAccumulator{}
+	)
+	for i, item := range items {
+		acc.Add(item)
+		assert.Equal(t, i+1, acc.Len())
+		assert.Equal(t, NewMerkleTree(items[:i+1]).Root(), acc.Root(), "%d items", i+1)
+	}
+}
+
+// A duplicated last item changes the root, unlike in trees hashing a lone
+// node with itself.
+func TestMerkleRootOddCount(t *testing.T) {
+	items := goldenItems(3)
+	assert.NotEqual(t, MerkleRoot(items), MerkleRoot(append(items, items[2])))
+}
+
+// An inner node can't be presented as a leaf.
+func TestMerkleLeavesAreDomainSeparated(t *testing.T) {
+	var (
+		items = goldenItems(2)
+		inner = hashMerkleNode(HashMerkleLeaf(items[0]), HashMerkleLeaf(items[1]))
+	)
+	assert.Equal(t, MerkleRoot(items), inner)
+	assert.NotEqual(t, inner, MerkleRoot([][]byte{inner}))
+}
+
+func TestMerkleTreeProofs(t *testing.T) {
+	for n := 1; n <= 20; n++ {
+		tree := NewMerkleTree(goldenItems(n))
+		for i, item := range goldenItems(n) {
+			hashes, err := tree.Proof(i)
+			require.NoError(t, err)
+			proof := &proto.MerkleProof{TxHash: item, Index: uint32(i), Total: uint32(n), Hashes: hashes}
+			assert.True(t, VerifyMerkleProof(proof, tree.Root()), "%d items, index %d", n, i)
+		}
+	}
+	_, err := NewMerkleTree(nil).Proof(0)
+	assert.Error(t, err)
+}
+
+func TestNewMerkleProofIndexOutOfRange(t *testing.T) {
+	block := blockWithTxs(2)
+	_, err := NewMerkleProof(block, 2)
+	assert.Error(t, err)
+	_, err = NewMerkleProof(block, -1)
+	assert.Error(t, err)
+}
+
+func TestVerifyMerkleProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		block := blockWithTxs(n)
+		SignBlock(crypto.GeneratePrivateKey(), block)
+		for i, tx := range block.Transactions {
+			proof, err := NewMerkleProofForTx(block, HashTransaction(tx))
+			require.NoError(t, err)
+			assert.Equal(t, uint32(i), proof.Index)
+			assert.True(t, VerifyTxInclusion(block.Header, tx, proof), "%d txs, index %d", n, i)
+		}
+	}
+}
+
+func TestVerifyMerkleProofRejectsForgeries(t *testing.T) {
+	block := blockWithTxs(5)
+	SignBlock(crypto.GeneratePrivateKey(), block)
+	tx := block.Transactions[2]
+	proof, err := NewMerkleProof(block, 2)
+	require.NoError(t, err)
+	require.True(t, VerifyTxInclusion(block.Header, tx, proof))
+
+	assert.False(t, VerifyTxInclusion(block.Header, block.Transactions[3], proof))
+	assert.False(t, VerifyMerkleProof(proof, util.RandomHash()))
+	assert.False(t, VerifyMerkleProof(nil, block.Header.RootHash))
+
+	forged := pb.Clone(proof).(*proto.MerkleProof)
+	forged.Index = 3
+	assert.False(t, VerifyMerkleProof(forged, block.Header.RootHash))
+
+	forged = pb.Clone(proof).(*proto.MerkleProof)
+	forged.Index += 1 << len(forged.Hashes)
+	assert.False(t, VerifyMerkleProof(forged, block.Header.RootHash))
+
+	forged = pb.Clone(proof).(*proto.MerkleProof)
+	forged.Hashes = forged.Hashes[1:]
+	assert.False(t, VerifyMerkleProof(forged, block.Header.RootHash))
+
+	forged = pb.Clone(proof).(*proto.MerkleProof)
+	forged.Total = 4
+	assert.False(t, VerifyMerkleProof(forged, block.Header.RootHash))
+
+	forged = pb.Clone(proof).(*proto.MerkleProof)
+	forged.Index = forged.Total
+	assert.False(t, VerifyMerkleProof(forged, block.Header.RootHash))
+
+	_, err = NewMerkleProofForTx(block, util.RandomHash())
+	assert.Error(t, err)
+}
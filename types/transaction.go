@@ -3,42 +3,81 @@ package types
 import (
 	"crypto/sha256"
 
-	pb "github.com/golang/protobuf/proto"
 	"github.com/vazj/blocker/crypto"
 	"github.com/vazj/blocker/proto"
 )
 
+// SignTransaction signs the ID of tx, which doesn't depend on the
+// signatures so the inputs can be signed in any order.
 func SignTransaction(pk *crypto.PrivateKey, tx *proto.Transaction) *crypto.Signature {
 	return pk.Sign(HashTransaction(tx))
 }
 
+// txDomain prefixes the encoding of the transactions.
+const txDomain = "blocker/tx"
+
+// HashTransaction returns the ID of tx, the SHA256 of its canonical
+// encoding without the witness. Outputs are spent by ID, which attaching or
+// altering signatures doesn't change, so transactions spending unconfirmed
+// ones can't be broken by a relay rewriting a signature.
 func HashTransaction(tx *proto.Transaction) []byte {
-	b, err := pb.Marshal(tx)
-	if err != nil {
-		panic(err)
-	}
-	hash := sha256.Sum256(b)
+	e := &encoder{}
+	encodeTxBody(e, tx)
+	hash := sha256.Sum256(e.buf)
+	return hash[:]
+}
+
+// WitnessHash returns the SHA256 of the whole canonical encoding of tx,
+// signatures included.
+func WitnessHash(tx *proto.Transaction) []byte {
+	hash := sha256.Sum256(EncodeTransaction(tx))
 	return hash[:]
 }
 
+// EncodeTransaction returns the canonical encoding of tx: the domain, the
+// version, the inputs and the outputs, each list prefixed with its length,
+// followed by the witness, the signatures of the inputs. Unknown protobuf
+// fields are left out.
+func EncodeTransaction(tx *proto.Transaction) []byte {
+	e := &encoder{}
+	encodeTxBody(e, tx)
+	e.uint32(uint32(len(tx.Inputs)))
+	for _, input := range tx.Inputs {
+		e.bytes(input.Signature)
+	}
+	return e.buf
+}
+
+// encodeTxBody encodes everything in tx but the signatures.
+func encodeTxBody(e *encoder, tx *proto.Transaction) {
+	e.bytes([]byte(txDomain))
+	e.int32(tx.Version)
+	e.uint32(uint32(len(tx.Inputs)))
+	for _, input := range tx.Inputs {
+		e.bytes(input.PrevTxHash)
+		e.uint32(input.PrevOutIndex)
+		e.bytes(input.PublicKey)
+	}
+	e.uint32(uint32(len(tx.Outputs)))
+	for _, output := range tx.Outputs {
+		e.int64(output.Amount)
+		e.bytes(output.Address)
+	}
+}
+
 func VerifyTransaction(tx *proto.Transaction) bool {
+	hash := HashTransaction(tx)
+
 	for _, input := range tx.Inputs {
 		if len(input.PublicKey) != crypto.PubKeyLen ||
 			len(input.Signature) != crypto.SignatureLen {
-			panic("invalid public key or signature length")
-			//return false
+			return false
 		}
 		var (
 			sig    = crypto.SignatureFromBytes(input.Signature)
 			pubKey = crypto.PublicKeyFromBytes(input.PublicKey)
 		)
-
-		// TODO: We need to set the signature to nil before hashing the transaction
-		// because the signature is part of the transaction.
-		// We don't want to hash the signature.
-		// make sure we don't run into problems with this
-		input.Signature = nil
-		if !sig.Verify(pubKey, HashTransaction(tx)) {
+		if !sig.Verify(pubKey, hash) {
 			return false
 		}
 	}
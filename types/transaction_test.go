@@ -1,12 +1,17 @@
 package types
 
 import (
+	"bytes"
+	"encoding/hex"
 	"testing"
 
+	pb "github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/vazj/blocker/crypto"
 	"github.com/vazj/blocker/proto"
 	"github.com/vazj/blocker/util"
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
 // my balance is 100 coins
@@ -49,3 +54,91 @@ func TestNewTransaction(t *testing.T) {
 
 	assert.True(t, VerifyTransaction(&tx))
 }
+
+func TestVerifyTransactionKeepsSignatures(t *testing.T) {
+	var (
+		privKey1 = crypto.GeneratePrivateKey()
+		privKey2 = crypto.GeneratePrivateKey()
+		tx       = &proto.Transaction{
+			Version: 1,
+			Inputs: []*proto.TxInput{
+				{PrevTxHash: util.RandomHash(), PublicKey: privKey1.Public().Bytes()},
+				{PrevTxHash: util.RandomHash(), PublicKey: privKey2.Public().Bytes()},
+			},
+			Outputs: []*proto.TxOutput{
+				{Amount: 10, Address: privKey1.Public().Address().Bytes()},
+			},
+		}
+	)
+	assert.False(t, VerifyTransaction(tx))
+
+	sig1 := SignTransaction(privKey1, tx)
+	sig2 := SignTransaction(privKey2, tx)
+	tx.Inputs[0].Signature = sig1.Bytes()
+	tx.Inputs[1].Signature = sig2.Bytes()
+
+	assert.True(t, VerifyTransaction(tx))
+	assert.Equal(t, sig1.Bytes(), tx.Inputs[0].Signature)
+	assert.Equal(t, sig2.Bytes(), tx.Inputs[1].Signature)
+	assert.True(t, VerifyTransaction(tx))
+}
+
+// goldenTx returns the transaction of the golden vectors.
+func goldenTx() *proto.Transaction {
+	return &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash:   bytes.Repeat([]byte{1}, 32),
+			PrevOutIndex: 2,
+			PublicKey:    bytes.Repeat([]byte{2}, 32),
+			Signature:    bytes.Repeat([]byte{3}, 64),
+		}},
+		Outputs: []*proto.TxOutput{
+			{Amount: 500, Address: bytes.Repeat([]byte{4}, 20)},
+			{Amount: 250, Address: bytes.Repeat([]byte{5}, 20)},
+		},
+	}
+}
+
+// The ID of a transaction must never change: outputs are spent by it.
+func TestHashTransactionGoldenVector(t *testing.T) {
+	assert.Equal(t, "ca0238438deff886a0e93b94ccb01dc3d74705431154a80d73dbd6a81861a427", hex.EncodeToString(HashTransaction(goldenTx())))
+	assert.Equal(t, "aba6724f5fdba7bc6d3443959b02c52eb4228be59646568be956e36091cf4d58", hex.EncodeToString(WitnessHash(goldenTx())))
+}
+
+func TestSignaturesDontChangeTheID(t *testing.T) {
+	var (
+		tx      = goldenTx()
+		id      = HashTransaction(tx)
+		witness = WitnessHash(tx)
+	)
+	tx.Inputs[0].Signature = bytes.Repeat([]byte{9}, 64)
+	assert.Equal(t, id, HashTransaction(tx))
+	assert.NotEqual(t, witness, WitnessHash(tx))
+}
+
+func TestHashTransactionIgnoresUnknownFields(t *testing.T) {
+	var (
+		tx       = goldenTx()
+		hash     = HashTransaction(tx)
+		b, err   = pb.Marshal(tx)
+		withJunk = &proto.Transaction{}
+	)
+	require.NoError(t, err)
+	// field 15 isn't part of the transaction message
+	b = protowire.AppendTag(b, 15, protowire.BytesType)
+	b = protowire.AppendBytes(b, []byte("junk"))
+	require.NoError(t, pb.Unmarshal(b, withJunk))
+	assert.Equal(t, hash, HashTransaction(withJunk))
+}
+
+func TestEncodeTransactionIsInjective(t *testing.T) {
+	var (
+		a = goldenTx()
+		b = goldenTx()
+	)
+	// move a byte from the hash of the previous tx to the public key
+	b.Inputs[0].PrevTxHash = b.Inputs[0].PrevTxHash[:31]
+	b.Inputs[0].PublicKey = append([]byte{1}, b.Inputs[0].PublicKey...)
+	assert.NotEqual(t, HashTransaction(a), HashTransaction(b))
+}
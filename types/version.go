@@ -0,0 +1,42 @@
+package types
+
+import (
+	"crypto/sha256"
+
+	pb "github.com/golang/protobuf/proto"
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/proto"
+)
+
+// SignVersion signs v with the node's identity key, binding the public key
+// and the nonce being answered to the rest of the version.
+func SignVersion(pk *crypto.PrivateKey, v *proto.Version) *crypto.Signature {
+	v.PublicKey = pk.Public().Bytes()
+	v.Signature = nil
+	sig := pk.Sign(HashVersion(v))
+	v.Signature = sig.Bytes()
+	return sig
+}
+
+// HashVersion returns a SHA256 of the version without its signature.
+func HashVersion(v *proto.Version) []byte {
+	unsigned := pb.Clone(v).(*proto.Version)
+	unsigned.Signature = nil
+	b, err := pb.Marshal(unsigned)
+	if err != nil {
+		panic(err)
+	}
+	hash := sha256.Sum256(b)
+	return hash[:]
+}
+
+func VerifyVersion(v *proto.Version) bool {
+	if len(v.PublicKey) != crypto.PubKeyLen || len(v.Signature) != crypto.SignatureLen {
+		return false
+	}
+	var (
+		sig    = crypto.SignatureFromBytes(v.Signature)
+		pubKey = crypto.PublicKeyFromBytes(v.PublicKey)
+	)
+	return sig.Verify(pubKey, HashVersion(v))
+}
@@ -0,0 +1,40 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/util"
+)
+
+func TestSignVerifyVersion(t *testing.T) {
+	var (
+		privKey = crypto.GeneratePrivateKey()
+		v       = &proto.Version{
+			Version:    "Blocker-1",
+			ListenAddr: ":3000",
+			Nonce:      util.RandomHash(),
+		}
+	)
+	sig := SignVersion(privKey, v)
+	assert.Equal(t, privKey.Public().Bytes(), v.PublicKey)
+	assert.Equal(t, sig.Bytes(), v.Signature)
+	assert.True(t, VerifyVersion(v))
+
+	// claiming another address invalidates the signature
+	v.ListenAddr = ":4000"
+	assert.False(t, VerifyVersion(v))
+	v.ListenAddr = ":3000"
+
+	// answering another challenge invalidates the signature
+	v.Nonce = util.RandomHash()
+	assert.False(t, VerifyVersion(v))
+
+	v.PublicKey = crypto.GeneratePrivateKey().Public().Bytes()
+	assert.False(t, VerifyVersion(v))
+
+	v.Signature = nil
+	assert.False(t, VerifyVersion(v))
+}
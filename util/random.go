@@ -1,8 +1,7 @@
 package util
 
 import (
-	randc "crypto/rand"
-	"math/rand"
+	"crypto/rand"
 	"time"
 
 	"github.com/vazj/blocker/proto"
@@ -10,17 +9,30 @@ import (
 
 func RandomHash() []byte {
 	hash := make([]byte, 32)
-	randc.Read(hash)
+	rand.Read(hash)
 	return hash
 }
 
+// RandomBlock returns an unsigned block with random hashes at height 1, on
+// top of a random parent.
 func RandomBlock() *proto.Block {
+	return RandomBlockAfter(&proto.Header{}, RandomHash())
+}
+
+// RandomBlockAfter returns an unsigned block with a random root extending
+// prev, whose hash is prevHash: one higher and timestamped now, or right
+// after prev if its clock is ahead.
+func RandomBlockAfter(prev *proto.Header, prevHash []byte) *proto.Block {
+	timestamp := time.Now().UnixNano()
+	if timestamp <= prev.Timestamp {
+		timestamp = prev.Timestamp + 1
+	}
 	header := &proto.Header{
-		Version:   1,
-		Height:    int32(rand.Intn(1000) + 1),
-		PrevHash:  RandomHash(),
+		Version:   3,
+		Height:    prev.Height + 1,
+		PrevHash:  prevHash,
 		RootHash:  RandomHash(),
-		Timestamp: time.Now().UnixNano(),
+		Timestamp: timestamp,
 	}
 
 	return &proto.Block{Header: header}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/node"
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/types"
+	"github.com/vazj/blocker/wallet"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// queryTimeout bounds every call the wallet makes to the node.
+const queryTimeout = 10 * time.Second
+
+// walletFlags are the flags shared by the wallet commands.
+type walletFlags struct {
+	fs       *flag.FlagSet
+	dir      string
+	nodeAddr string
+	// tls holds the settings of nodes serving over TLS, the node is
+	// verified against CAFile or its identity in TrustedIdentities.
+	tls          node.TLSConfig
+	nodeIdentity string
+}
+
+func newWalletFlags(name string, out io.Writer) *walletFlags {
+	f := &walletFlags{fs: flag.NewFlagSet(name, flag.ContinueOnError)}
+	f.fs.SetOutput(out)
+	f.fs.StringVar(&f.dir, "dir", envOr("WALLET_DIR", filepath.Join(".blocker", "wallet")), "directory holding the wallet keys")
+	f.fs.StringVar(&f.nodeAddr, "node", envOr("NODE", "localhost:3000"), "address of the node to query")
+	f.fs.BoolVar(&f.tls.Enabled, "tls", false, "connect to the node over TLS")
+	f.fs.StringVar(&f.tls.CAFile, "tls-ca", "", "PEM bundle of the authorities the node certificate chains up to")
+	f.fs.StringVar(&f.tls.CertFile, "tls-cert", "", "PEM client certificate, for nodes requiring mutual TLS")
+	f.fs.StringVar(&f.tls.KeyFile, "tls-key", "", "PEM key of the client certificate")
+	f.fs.StringVar(&f.nodeIdentity, "node-identity", "", "hex identity key of a node with a self-signed certificate")
+	return f
+}
+
+// envOr returns the value of the environment variable name, prefixed with
+// envPrefix, or def when it isn't set.
+func envOr(name, def string) string {
+	if v, ok := os.LookupEnv(envPrefix + name); ok {
+		return v
+	}
+	return def
+}
+
+// dial connects to the node whose Query and Node services the wallet uses.
+func (f *walletFlags) dial() (*grpc.ClientConn, error) {
+	if !f.tls.Enabled {
+		return grpc.Dial(f.nodeAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	if f.tls.CAFile == "" && f.nodeIdentity == "" {
+		return nil, errors.New("-tls needs -tls-ca or -node-identity to verify the node")
+	}
+	if f.nodeIdentity != "" {
+		f.tls.TrustedIdentities = []string{f.nodeIdentity}
+	}
+	// without a client certificate, nodes requiring one get a self-signed
+	// certificate of a throwaway identity
+	creds, err := f.tls.ClientCredentials(crypto.GeneratePrivateKey())
+	if err != nil {
+		return nil, err
+	}
+	return grpc.Dial(f.nodeAddr, grpc.WithTransportCredentials(creds))
+}
+
+func runWallet(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "new":
+		return runWalletNew(args[1:], out)
+	case "mnemonic":
+		return runWalletMnemonic(args[1:], out)
+	case "restore":
+		return runWalletRestore(args[1:], out)
+	case "list":
+		return runWalletList(args[1:], out)
+	case "balance":
+		return runWalletBalance(args[1:], out)
+	case "send":
+		return runWalletSend(args[1:], out)
+	}
+	return errUsage
+}
+
+func runWalletNew(args []string, out io.Writer) error {
+	flags := newWalletFlags("wallet new", out)
+	if ok, err := parseFlags(flags.fs, args); !ok {
+		return err
+	}
+	w, err := wallet.Open(flags.dir)
+	if err != nil {
+		return err
+	}
+	privKey, err := w.NewKey()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, privKey.Public().Address())
+	return nil
+}
+
+func runWalletMnemonic(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("wallet mnemonic", flag.ContinueOnError)
+	fs.SetOutput(out)
+	if ok, err := parseFlags(fs, args); !ok {
+		return err
+	}
+	fmt.Fprintln(out, crypto.GenerateMnemonic())
+	return nil
+}
+
+func runWalletRestore(args []string, out io.Writer) error {
+	var (
+		flags        = newWalletFlags("wallet restore", out)
+		mnemonicFile = flags.fs.String("mnemonic-file", "", "file holding the mnemonic, kept off the command line")
+		passphrase   = flags.fs.String("passphrase", "", "passphrase the mnemonic was protected with")
+		count        = flags.fs.Int("count", 1, "number of keys to restore")
+	)
+	if ok, err := parseFlags(flags.fs, args); !ok {
+		return err
+	}
+	if *mnemonicFile == "" {
+		return errors.New("missing -mnemonic-file")
+	}
+	mnemonic, err := os.ReadFile(*mnemonicFile)
+	if err != nil {
+		return err
+	}
+	w, err := wallet.Open(flags.dir)
+	if err != nil {
+		return err
+	}
+	keys, err := w.Restore(string(mnemonic), *passphrase, *count)
+	if err != nil {
+		return err
+	}
+	for _, privKey := range keys {
+		fmt.Fprintln(out, privKey.Public().Address())
+	}
+	return nil
+}
+
+func runWalletList(args []string, out io.Writer) error {
+	flags := newWalletFlags("wallet list", out)
+	if ok, err := parseFlags(flags.fs, args); !ok {
+		return err
+	}
+	w, err := wallet.Open(flags.dir)
+	if err != nil {
+		return err
+	}
+	for _, addr := range w.Addresses() {
+		fmt.Fprintln(out, addr)
+	}
+	return nil
+}
+
+// walletUTXOs returns the unspent outputs of every wallet address, by
+// address.
+func walletUTXOs(ctx context.Context, c proto.QueryClient, w *wallet.Wallet) (map[string][]*proto.UTXO, error) {
+	utxos := make(map[string][]*proto.UTXO)
+	for _, addr := range w.Addresses() {
+		for {
+			list, err := c.GetUTXOs(ctx, &proto.AddressRequest{
+				Address: addr.Bytes(),
+				Offset:  uint32(len(utxos[addr.String()])),
+			})
+			if err != nil {
+				return nil, err
+			}
+			utxos[addr.String()] = append(utxos[addr.String()], list.Utxos...)
+			if len(list.Utxos) == 0 || len(utxos[addr.String()]) >= int(list.Total) {
+				break
+			}
+		}
+	}
+	return utxos, nil
+}
+
+func runWalletBalance(args []string, out io.Writer) error {
+	flags := newWalletFlags("wallet balance", out)
+	if ok, err := parseFlags(flags.fs, args); !ok {
+		return err
+	}
+	w, err := wallet.Open(flags.dir)
+	if err != nil {
+		return err
+	}
+	conn, err := flags.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	c := proto.NewQueryClient(conn)
+	total := int64(0)
+	for _, addr := range w.Addresses() {
+		balance, err := c.GetBalance(ctx, &proto.AddressRequest{Address: addr.Bytes()})
+		if err != nil {
+			return err
+		}
+		total += balance.Amount
+		fmt.Fprintf(out, "%s %d\n", addr, balance.Amount)
+	}
+	fmt.Fprintf(out, "total %d\n", total)
+	return nil
+}
+
+func runWalletSend(args []string, out io.Writer) error {
+	var (
+		flags  = newWalletFlags("wallet send", out)
+		to     = flags.fs.String("to", "", "address to send the coins to")
+		amount = flags.fs.Int64("amount", 0, "amount of coins to send")
+		fee    = flags.fs.Int64("fee", 0, "fee left out of the outputs, burnt")
+		change = flags.fs.String("change", "", "address the change goes to, the first spent address when empty")
+	)
+	if ok, err := parseFlags(flags.fs, args); !ok {
+		return err
+	}
+	payment := wallet.Payment{Amount: *amount, Fee: *fee}
+	var err error
+	if payment.To, err = wallet.ParseAddress(*to); err != nil {
+		return err
+	}
+	if *change != "" {
+		if payment.Change, err = wallet.ParseAddress(*change); err != nil {
+			return err
+		}
+	}
+	w, err := wallet.Open(flags.dir)
+	if err != nil {
+		return err
+	}
+	if len(w.Addresses()) == 0 {
+		return errors.New("the wallet has no keys")
+	}
+	conn, err := flags.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	c := proto.NewQueryClient(conn)
+	byAddr, err := walletUTXOs(ctx, c, w)
+	if err != nil {
+		return err
+	}
+	utxos := make([]*proto.UTXO, 0)
+	for _, addrUTXOs := range byAddr {
+		utxos = append(utxos, addrUTXOs...)
+	}
+	// the outputs spent by transactions waiting in the mempool are still
+	// unspent on chain. The node only lists part of a large mempool, it
+	// rejects a transaction spending the same output as an unlisted one.
+	mempool, err := c.GetMempool(ctx, &proto.Ack{})
+	if err != nil {
+		return err
+	}
+	utxos = wallet.ExcludeSpent(utxos, mempool.Transactions)
+	tx, err := w.BuildTransaction(utxos, payment)
+	if err != nil {
+		return err
+	}
+	if _, err := proto.NewNodeClient(conn).HandleTransaction(ctx, tx); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, hex.EncodeToString(types.HashTransaction(tx)))
+	return nil
+}
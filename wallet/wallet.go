@@ -0,0 +1,257 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/node"
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/types"
+)
+
+// keyExt is the extension of the key files in a wallet directory.
+const keyExt = ".key"
+
+var (
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrUnknownAddress    = errors.New("address doesn't belong to the wallet")
+	ErrInvalidAmount     = errors.New("invalid amount")
+)
+
+// Wallet is a set of keys stored in a directory, one file per key named
+// after its address.
+type Wallet struct {
+	dir  string
+	keys map[string]*crypto.PrivateKey
+}
+
+// Open loads the keys stored in dir, which doesn't have to exist yet.
+func Open(dir string) (*Wallet, error) {
+	w := &Wallet{
+		dir:  dir,
+		keys: make(map[string]*crypto.PrivateKey),
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return w, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != keyExt {
+			continue
+		}
+		privKey, err := node.LoadKey(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", entry.Name(), err)
+		}
+		w.add(privKey)
+	}
+	return w, nil
+}
+
+func (w *Wallet) add(privKey *crypto.PrivateKey) {
+	w.keys[privKey.Public().Address().String()] = privKey
+}
+
+// NewKey generates a key and stores it in the wallet directory.
+func (w *Wallet) NewKey() (*crypto.PrivateKey, error) {
+	privKey := crypto.GeneratePrivateKey()
+	if err := w.save(privKey); err != nil {
+		return nil, err
+	}
+	return privKey, nil
+}
+
+// save stores privKey in the wallet directory and adds it to the wallet.
+func (w *Wallet) save(privKey *crypto.PrivateKey) error {
+	path := filepath.Join(w.dir, privKey.Public().Address().String()+keyExt)
+	if err := node.SaveKey(path, privKey); err != nil {
+		return err
+	}
+	w.add(privKey)
+	return nil
+}
+
+// DerivationPath returns the path of the key at index in the key tree of a
+// mnemonic, following BIP-44 with the coin type 1 of test networks. Every
+// level is hardened since ed25519 keys have no other children.
+func DerivationPath(index int) string {
+	return fmt.Sprintf("m/44'/1'/0'/0'/%d'", index)
+}
+
+// Restore derives the first count keys of mnemonic and stores the ones the
+// wallet doesn't have yet. It returns the derived keys in order.
+func (w *Wallet) Restore(mnemonic, passphrase string, count int) ([]*crypto.PrivateKey, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("invalid key count %d", count)
+	}
+	master, err := crypto.NewMasterKeyFromMnemonic(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*crypto.PrivateKey, 0, count)
+	for i := 0; i < count; i++ {
+		k, err := master.Derive(DerivationPath(i))
+		if err != nil {
+			return nil, err
+		}
+		privKey := k.PrivateKey()
+		keys = append(keys, privKey)
+		if _, ok := w.Key(privKey.Public().Address().Bytes()); ok {
+			continue
+		}
+		if err := w.save(privKey); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// Addresses returns the addresses of the wallet keys in a stable order.
+func (w *Wallet) Addresses() []*crypto.Address {
+	addrs := make([]string, 0, len(w.keys))
+	for addr := range w.keys {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	addresses := make([]*crypto.Address, 0, len(addrs))
+	for _, addr := range addrs {
+		addresses = append(addresses, w.keys[addr].Public().Address())
+	}
+	return addresses
+}
+
+// Key returns the key of address.
+func (w *Wallet) Key(address []byte) (*crypto.PrivateKey, bool) {
+	privKey, ok := w.keys[hex.EncodeToString(address)]
+	return privKey, ok
+}
+
+// SelectCoins picks the largest outputs first until they cover target,
+// which keeps the number of inputs, and so the transaction size, low. It
+// returns the selected outputs and their sum.
+func SelectCoins(utxos []*proto.UTXO, target int64) ([]*proto.UTXO, int64, error) {
+	sorted := make([]*proto.UTXO, len(utxos))
+	copy(sorted, utxos)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Amount > sorted[j].Amount })
+
+	var (
+		selected = make([]*proto.UTXO, 0)
+		sum      = int64(0)
+	)
+	for _, utxo := range sorted {
+		if sum >= target {
+			break
+		}
+		selected = append(selected, utxo)
+		sum += utxo.Amount
+	}
+	if sum < target {
+		return nil, 0, fmt.Errorf("%w: have %d, need %d", ErrInsufficientFunds, sum, target)
+	}
+	return selected, sum, nil
+}
+
+// ExcludeSpent returns the outputs of utxos that none of the pending
+// transactions spends, so that coins already in the mempool aren't selected
+// twice.
+func ExcludeSpent(utxos []*proto.UTXO, pending []*proto.Transaction) []*proto.UTXO {
+	spent := make(map[string]bool)
+	for _, tx := range pending {
+		for _, input := range tx.Inputs {
+			spent[outpoint(input.PrevTxHash, input.PrevOutIndex)] = true
+		}
+	}
+	unspent := make([]*proto.UTXO, 0, len(utxos))
+	for _, utxo := range utxos {
+		if !spent[outpoint(utxo.TxHash, utxo.OutIndex)] {
+			unspent = append(unspent, utxo)
+		}
+	}
+	return unspent
+}
+
+func outpoint(txHash []byte, index uint32) string {
+	return fmt.Sprintf("%x:%d", txHash, index)
+}
+
+// Payment describes a transfer of Amount coins to To, sending the change
+// back to Change, or to the address of the first spent output when Change is
+// empty. Fee is left out of the outputs and, as blocks don't pay their
+// validator, burnt.
+type Payment struct {
+	To     []byte
+	Amount int64
+	Fee    int64
+	Change []byte
+}
+
+// BuildTransaction creates a transaction for p funded by utxos, which
+// have to pay to wallet addresses, and signs every input with the key of
+// the output it spends.
+func (w *Wallet) BuildTransaction(utxos []*proto.UTXO, p Payment) (*proto.Transaction, error) {
+	if p.Amount <= 0 || p.Fee < 0 {
+		return nil, ErrInvalidAmount
+	}
+	if len(p.To) != crypto.AddressLen || (p.Change != nil && len(p.Change) != crypto.AddressLen) {
+		return nil, fmt.Errorf("invalid address length")
+	}
+	selected, sum, err := SelectCoins(utxos, p.Amount+p.Fee)
+	if err != nil {
+		return nil, err
+	}
+	if p.Change == nil {
+		p.Change = selected[0].Address
+	}
+
+	tx := &proto.Transaction{
+		Version: 1,
+		Outputs: []*proto.TxOutput{
+			{
+				Amount:  p.Amount,
+				Address: p.To,
+			},
+		},
+	}
+	if change := sum - p.Amount - p.Fee; change > 0 {
+		tx.Outputs = append(tx.Outputs, &proto.TxOutput{
+			Amount:  change,
+			Address: p.Change,
+		})
+	}
+	keys := make([]*crypto.PrivateKey, 0, len(selected))
+	for _, utxo := range selected {
+		privKey, ok := w.Key(utxo.Address)
+		if !ok {
+			return nil, fmt.Errorf("%w: %x", ErrUnknownAddress, utxo.Address)
+		}
+		keys = append(keys, privKey)
+		tx.Inputs = append(tx.Inputs, &proto.TxInput{
+			PrevTxHash:   utxo.TxHash,
+			PrevOutIndex: utxo.OutIndex,
+			PublicKey:    privKey.Public().Bytes(),
+		})
+	}
+
+	for i, privKey := range keys {
+		tx.Inputs[i].Signature = types.SignTransaction(privKey, tx).Bytes()
+	}
+	return tx, nil
+}
+
+// ParseAddress decodes a hex encoded address.
+func ParseAddress(s string) ([]byte, error) {
+	address, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(address) != crypto.AddressLen {
+		return nil, fmt.Errorf("invalid address %q", s)
+	}
+	return address, nil
+}
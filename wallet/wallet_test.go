@@ -0,0 +1,147 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/proto"
+	"github.com/vazj/blocker/types"
+	"github.com/vazj/blocker/util"
+)
+
+func utxo(address []byte, amount int64) *proto.UTXO {
+	return &proto.UTXO{
+		TxHash:  util.RandomHash(),
+		Amount:  amount,
+		Address: address,
+	}
+}
+
+func TestOpenWallet(t *testing.T) {
+	dir := t.TempDir()
+	w, err := Open(dir)
+	require.NoError(t, err)
+	assert.Empty(t, w.Addresses())
+
+	a, err := w.NewKey()
+	require.NoError(t, err)
+	b, err := w.NewKey()
+	require.NoError(t, err)
+
+	w, err = Open(dir)
+	require.NoError(t, err)
+	assert.Len(t, w.Addresses(), 2)
+	for _, privKey := range []*crypto.PrivateKey{a, b} {
+		loaded, ok := w.Key(privKey.Public().Address().Bytes())
+		require.True(t, ok)
+		assert.True(t, privKey.Equals(loaded))
+	}
+}
+
+func TestSelectCoins(t *testing.T) {
+	address := crypto.GeneratePrivateKey().Public().Address().Bytes()
+	utxos := []*proto.UTXO{utxo(address, 10), utxo(address, 50), utxo(address, 30)}
+
+	selected, sum, err := SelectCoins(utxos, 60)
+	require.NoError(t, err)
+	assert.Equal(t, int64(80), sum)
+	require.Len(t, selected, 2)
+	assert.Equal(t, int64(50), selected[0].Amount)
+	assert.Equal(t, int64(30), selected[1].Amount)
+
+	_, _, err = SelectCoins(utxos, 91)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+}
+
+func TestExcludeSpent(t *testing.T) {
+	address := crypto.GeneratePrivateKey().Public().Address().Bytes()
+	utxos := []*proto.UTXO{utxo(address, 10), utxo(address, 50), utxo(address, 30)}
+	utxos[2].TxHash = utxos[1].TxHash
+	utxos[2].OutIndex = 1
+
+	pending := []*proto.Transaction{
+		{Inputs: []*proto.TxInput{{PrevTxHash: utxos[1].TxHash, PrevOutIndex: 0}}},
+		{Inputs: []*proto.TxInput{{PrevTxHash: util.RandomHash(), PrevOutIndex: 0}}},
+	}
+	assert.Equal(t, []*proto.UTXO{utxos[0], utxos[2]}, ExcludeSpent(utxos, pending))
+	assert.Equal(t, utxos, ExcludeSpent(utxos, nil))
+}
+
+func TestBuildTransaction(t *testing.T) {
+	w, err := Open(t.TempDir())
+	require.NoError(t, err)
+	a, err := w.NewKey()
+	require.NoError(t, err)
+	b, err := w.NewKey()
+	require.NoError(t, err)
+
+	var (
+		addrA = a.Public().Address().Bytes()
+		addrB = b.Public().Address().Bytes()
+		to    = crypto.GeneratePrivateKey().Public().Address().Bytes()
+		utxos = []*proto.UTXO{utxo(addrA, 40), utxo(addrB, 50)}
+	)
+	tx, err := w.BuildTransaction(utxos, Payment{To: to, Amount: 80, Fee: 3})
+	require.NoError(t, err)
+
+	require.Len(t, tx.Inputs, 2)
+	assert.Equal(t, b.Public().Bytes(), tx.Inputs[0].PublicKey)
+	assert.Equal(t, a.Public().Bytes(), tx.Inputs[1].PublicKey)
+	require.Len(t, tx.Outputs, 2)
+	assert.Equal(t, to, tx.Outputs[0].Address)
+	assert.Equal(t, int64(80), tx.Outputs[0].Amount)
+	// the change goes back to the first spent address
+	assert.Equal(t, addrB, tx.Outputs[1].Address)
+	assert.Equal(t, int64(7), tx.Outputs[1].Amount)
+	assert.True(t, types.VerifyTransaction(tx))
+
+	// no change output when the amounts match
+	tx, err = w.BuildTransaction(utxos, Payment{To: to, Amount: 87, Fee: 3, Change: addrA})
+	require.NoError(t, err)
+	assert.Len(t, tx.Outputs, 1)
+
+	_, err = w.BuildTransaction(utxos, Payment{To: to, Amount: 90, Fee: 1})
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	_, err = w.BuildTransaction(utxos, Payment{To: to, Amount: 0})
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	_, err = w.BuildTransaction([]*proto.UTXO{utxo(to, 100)}, Payment{To: to, Amount: 10})
+	assert.ErrorIs(t, err, ErrUnknownAddress)
+}
+
+func TestRestore(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		mnemonic = crypto.GenerateMnemonic()
+	)
+	w, err := Open(dir)
+	require.NoError(t, err)
+	keys, err := w.Restore(mnemonic, "secret", 3)
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+	assert.Len(t, w.Addresses(), 3)
+
+	first, err := crypto.NewPrivateKeyFromMnemonic(mnemonic, "secret", DerivationPath(0))
+	require.NoError(t, err)
+	assert.True(t, first.Equals(keys[0]))
+
+	// restoring more keys into another wallet gives the same ones first
+	other, err := Open(t.TempDir())
+	require.NoError(t, err)
+	more, err := other.Restore(mnemonic, "secret", 5)
+	require.NoError(t, err)
+	for i, privKey := range keys {
+		assert.True(t, privKey.Equals(more[i]))
+	}
+
+	// the keys already in the wallet are kept as they are
+	_, err = w.Restore(mnemonic, "secret", 5)
+	require.NoError(t, err)
+	w, err = Open(dir)
+	require.NoError(t, err)
+	assert.Len(t, w.Addresses(), 5)
+
+	_, err = w.Restore(mnemonic+" abandon", "secret", 1)
+	assert.ErrorIs(t, err, crypto.ErrInvalidMnemonic)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vazj/blocker/crypto"
+	"github.com/vazj/blocker/node"
+	"github.com/vazj/blocker/wallet"
+)
+
+// startNode runs a node with cfg whose genesis pays 1000 coins to address.
+func startNode(t *testing.T, cfg node.ServerConfig, address []byte) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	cfg.Genesis = node.NewGenesisBlock(crypto.GeneratePrivateKey(), 0, []node.GenesisAlloc{
+		{Address: address, Amount: 1000},
+	})
+	n := node.NewNode(cfg)
+	go n.Start(addr, nil)
+	t.Cleanup(func() {
+		n.Stop(context.Background())
+	})
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, time.Second, 10*time.Millisecond)
+	return addr
+}
+
+func TestWalletSend(t *testing.T) {
+	dir := t.TempDir()
+	out := &bytes.Buffer{}
+	require.NoError(t, run([]string{"wallet", "new", "-dir", dir}, out))
+	address, err := wallet.ParseAddress(out.String())
+	require.NoError(t, err)
+
+	nodeAddr := startNode(t, node.ServerConfig{}, address)
+	flags := []string{"-dir", dir, "-node", nodeAddr}
+
+	out.Reset()
+	require.NoError(t, run(append([]string{"wallet", "balance"}, flags...), out))
+	assert.Contains(t, out.String(), "total 1000")
+
+	out.Reset()
+	to := crypto.GeneratePrivateKey().Public().Address().String()
+	require.NoError(t, run(append([]string{"wallet", "send", "-to", to, "-amount", "250", "-fee", "1"}, flags...), out))
+	assert.Regexp(t, regexp.MustCompile("^[0-9a-f]{64}$"), strings.TrimSpace(out.String()))
+
+	// the only coin is spent by the pending transaction, nothing is left
+	err = run(append([]string{"wallet", "send", "-to", to, "-amount", "10"}, flags...), out)
+	assert.ErrorIs(t, err, wallet.ErrInsufficientFunds)
+
+	err = run(append([]string{"wallet", "send", "-to", to, "-amount", "1001"}, flags...), out)
+	assert.ErrorIs(t, err, wallet.ErrInsufficientFunds)
+}
+
+func TestWalletTLS(t *testing.T) {
+	dir := t.TempDir()
+	out := &bytes.Buffer{}
+	require.NoError(t, run([]string{"wallet", "new", "-dir", dir}, out))
+	address, err := wallet.ParseAddress(out.String())
+	require.NoError(t, err)
+
+	identity := crypto.GeneratePrivateKey()
+	nodeAddr := startNode(t, node.ServerConfig{
+		IdentityKey: identity,
+		TLS:         node.TLSConfig{Enabled: true, MutualTLS: true},
+	}, address)
+	flags := []string{"-dir", dir, "-node", nodeAddr, "-tls"}
+
+	out.Reset()
+	require.NoError(t, run(append([]string{"wallet", "balance", "-node-identity", hex.EncodeToString(identity.Public().Bytes())}, flags...), out))
+	assert.Contains(t, out.String(), "total 1000")
+
+	// the node has to be verified
+	assert.Error(t, run(append([]string{"wallet", "balance"}, flags...), out))
+	other := hex.EncodeToString(crypto.GeneratePrivateKey().Public().Bytes())
+	assert.Error(t, run(append([]string{"wallet", "balance", "-node-identity", other}, flags...), out))
+}
+
+func TestWalletRestore(t *testing.T) {
+	out := &bytes.Buffer{}
+	require.NoError(t, run([]string{"wallet", "mnemonic"}, out))
+	mnemonic := strings.TrimSpace(out.String())
+	require.NoError(t, crypto.ValidateMnemonic(mnemonic))
+
+	mnemonicFile := filepath.Join(t.TempDir(), "mnemonic")
+	require.NoError(t, os.WriteFile(mnemonicFile, []byte(mnemonic+"\n"), 0600))
+
+	restore := func(dir string) string {
+		out := &bytes.Buffer{}
+		require.NoError(t, run([]string{"wallet", "restore", "-dir", dir, "-mnemonic-file", mnemonicFile, "-count", "2"}, out))
+		return out.String()
+	}
+	dir := t.TempDir()
+	addresses := restore(dir)
+	assert.Len(t, strings.Fields(addresses), 2)
+	assert.Equal(t, addresses, restore(t.TempDir()))
+
+	out.Reset()
+	require.NoError(t, run([]string{"wallet", "list", "-dir", dir}, out))
+	assert.ElementsMatch(t, strings.Fields(addresses), strings.Fields(out.String()))
+}